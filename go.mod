@@ -4,6 +4,7 @@ go 1.14
 
 require (
 	github.com/jackc/pgconn v1.7.0
+	github.com/jackc/pgproto3/v2 v2.0.5
 	github.com/jackc/pgtype v1.5.0
 	github.com/jackc/pgx/v4 v4.9.0
 )
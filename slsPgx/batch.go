@@ -0,0 +1,137 @@
+package slsPgx
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// BatchError is returned when a statement queued in a batch fails,
+// Index is the position of the statement in the batch.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch statement %v failed: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// SendBatch works like pgx.Conn.SendBatch. If the backend has been terminated, or the connection
+// closed, before any result was read, the whole batch is sent again on a new connection.
+// The connection is held until the batch results are closed.
+func (s *SlsConn) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	s.mu.Lock()
+
+	return &slsBatchResults{
+		s:       s,
+		ctx:     ctx,
+		batch:   b,
+		results: s.conn.SendBatch(ctx, b),
+		sentOn:  s.conn,
+		release: s.releaseFunc(),
+	}
+}
+
+type slsBatchResults struct {
+	s       *SlsConn
+	ctx     context.Context
+	batch   *pgx.Batch
+	results pgx.BatchResults
+	// sentOn is the connection the batch has been sent on
+	sentOn  *pgx.Conn
+	read    int
+	release func()
+}
+
+func (r *slsBatchResults) Exec() (pgconn.CommandTag, error) {
+	var commandTag pgconn.CommandTag
+	err := r.next(func(results pgx.BatchResults) error {
+		var err error
+		commandTag, err = results.Exec()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return commandTag, nil
+}
+
+func (r *slsBatchResults) Query() (pgx.Rows, error) {
+	var rows pgx.Rows
+	err := r.next(func(results pgx.BatchResults) error {
+		var err error
+		rows, err = results.Query()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+func (r *slsBatchResults) QueryRow() pgx.Row {
+	return &slsBatchRow{results: r}
+}
+
+func (r *slsBatchResults) Close() error {
+	defer r.release()
+
+	if r.read > 0 {
+		return r.results.Close()
+	}
+
+	return r.retry(func(results pgx.BatchResults) error {
+		return results.Close()
+	})
+}
+
+// next reads the result of the next queued statement. Only the first read can be retried,
+// once a result has been read the batch cannot be sent again.
+func (r *slsBatchResults) next(fn func(results pgx.BatchResults) error) error {
+	index := r.read
+	r.read++
+
+	var err error
+	if index == 0 {
+		err = r.retry(fn)
+	} else {
+		err = fn(r.results)
+	}
+	if err != nil {
+		return &BatchError{Index: index, Err: err}
+	}
+
+	return nil
+}
+
+// retry reads the first result, the batch is sent again whenever retry has replaced the connection
+// it was sent on, including when that connection was already closed before the first attempt.
+func (r *slsBatchResults) retry(fn func(results pgx.BatchResults) error) error {
+	return r.s.retry(r.ctx, func(conn *pgx.Conn) error {
+		if conn != r.sentOn {
+			_ = r.results.Close()
+			r.results = conn.SendBatch(r.ctx, r.batch)
+			r.sentOn = conn
+		}
+
+		return fn(r.results)
+	})
+}
+
+type slsBatchRow struct {
+	results *slsBatchResults
+}
+
+func (r *slsBatchRow) Scan(dest ...interface{}) error {
+	return r.results.next(func(results pgx.BatchResults) error {
+		return results.QueryRow().Scan(dest...)
+	})
+}
@@ -0,0 +1,310 @@
+package slsPgx
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"sync"
+	"time"
+)
+
+// querier is implemented by both *pgx.Conn and *pgxpool.Pool.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+// maxConnections caches the max_connections of the server, it is shared by concurrent cleaners of SlsPool.
+type maxConnections struct {
+	mu        sync.Mutex
+	value     int
+	updatedAt time.Time
+}
+
+// cleaner collects the zombie connections, it is shared by SlsConn and SlsPool.
+type cleaner struct {
+	db             querier
+	config         slsConnConfig
+	connCred       connCred
+	logger         Logger
+	maxConnections *maxConnections
+	// clock tells when the cached max_connections expires
+	clock Clock
+	// connections that are expected to be opened on top of the current ones
+	pending int
+	// pids that must never be terminated, on top of the ExcludePids of the config
+	excludedPids []int
+	// when not empty only the connections whose application_name starts with it are terminated
+	applicationNamePrefix string
+}
+
+// getMaxConnections returns the number of connections available to non superusers.
+// The value is fetched from the server and cached for MaxConnectionsFreqMs, unless
+// ManualMaxConnections is set, in which case MaxConnections is used as it is.
+func (c cleaner) getMaxConnections(ctx context.Context) (int, error) {
+	if c.config.ManualMaxConnections {
+		return c.config.MaxConnections, nil
+	}
+
+	c.maxConnections.mu.Lock()
+	defer c.maxConnections.mu.Unlock()
+
+	freq := time.Duration(float64(c.config.MaxConnectionsFreqMs) * float64(time.Millisecond))
+	if c.maxConnections.value > 0 && c.clock.Now().Sub(c.maxConnections.updatedAt) < freq {
+		return c.maxConnections.value, nil
+	}
+
+	query := `
+	SELECT current_setting('max_connections')::int - current_setting('superuser_reserved_connections')::int;`
+	var value int
+
+	if err := c.db.QueryRow(ctx, query).Scan(&value); err != nil {
+		return 0, err
+	}
+
+	c.maxConnections.value = value
+	c.maxConnections.updatedAt = c.clock.Now()
+	c.logger.Info(fmt.Sprintf("Max connections: %v", value))
+
+	return value, nil
+}
+
+// CleanCandidate is an idle connection that Clean tries to terminate.
+type CleanCandidate struct {
+	Pid             int
+	IdleTime        time.Duration
+	ApplicationName string
+}
+
+// CleanResult describes what Clean observed and did.
+type CleanResult struct {
+	Utilization Utilization
+	// Threshold is the number of backends, ConnUtilization of Limit, above which idle connections are terminated.
+	Threshold  float32
+	Candidates []CleanCandidate
+	// Terminated and Failed are the pids of the candidates that have been terminated or not,
+	// e.g. because they were no longer idle.
+	Terminated []int
+	Failed     []int
+	Elapsed    time.Duration
+	// DryRun is set when the candidates have not been terminated, see SlsConn.CleanDryRun.
+	DryRun bool
+}
+
+func (c cleaner) getIdleProcessesListByMinimumTimeout(ctx context.Context) ([]CleanCandidate, error) {
+	query := `
+    WITH processes AS(
+      SELECT
+         EXTRACT(EPOCH FROM (Now() - state_change)) AS idle_time,
+         pid,
+         application_name
+      FROM pg_stat_activity
+      WHERE usename=$1
+        AND datname=$2
+        AND state='idle'
+        AND backend_type = 'client backend'
+        AND pid <> pg_backend_pid()
+        AND NOT (pid = ANY ($5))
+        AND NOT (application_name LIKE ANY ($6))
+        AND (client_addr IS NULL OR NOT (host(client_addr) = ANY ($7)))
+        AND ($8 = '' OR application_name = $8 OR left(application_name, length($8) + 1) = $8 || ':')
+    )
+    SELECT pid, idle_time, application_name
+    FROM processes
+    WHERE idle_time > $3
+    LIMIT $4;`
+
+	excludedPids := &pgtype.Int4Array{}
+	if err := excludedPids.Set(append(append([]int{}, c.excludedPids...), c.config.ExcludePids...)); err != nil {
+		return nil, err
+	}
+	excludedApplicationNames := &pgtype.TextArray{}
+	if err := excludedApplicationNames.Set(append([]string{}, c.config.ExcludeApplicationNames...)); err != nil {
+		return nil, err
+	}
+	excludedClientAddrs := &pgtype.TextArray{}
+	if err := excludedClientAddrs.Set(append([]string{}, c.config.ExcludeClientAddrs...)); err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.Query(
+		ctx,
+		query,
+		c.connCred.user,
+		c.connCred.database,
+		c.config.MinConnectionIdleTimeSec,
+		c.config.MaxIdleConnectionsToKill,
+		excludedPids,
+		excludedApplicationNames,
+		excludedClientAddrs,
+		c.applicationNamePrefix,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	candidates := make([]CleanCandidate, 0)
+
+	for rows.Next() {
+		var candidate CleanCandidate
+		var idleTime float64
+		if err := rows.Scan(&candidate.Pid, &idleTime, &candidate.ApplicationName); err != nil {
+			return nil, err
+		}
+		candidate.IdleTime = time.Duration(idleTime * float64(time.Second))
+
+		candidates = append(candidates, candidate)
+	}
+
+	return candidates, rows.Err()
+}
+
+// killProcesses terminates the given pids that are still idle and returns the ones that have been terminated.
+func (c cleaner) killProcesses(ctx context.Context, pids []int) ([]int, error) {
+	query := `
+	SELECT pid, pg_terminate_backend(pid)
+    FROM pg_stat_activity
+    WHERE pid = ANY ($1) AND state='idle' AND pid <> pg_backend_pid()`
+
+	ids := &pgtype.Int4Array{}
+	if err := ids.Set(append([]int{}, pids...)); err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.Query(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	terminated := make([]int, 0)
+
+	for rows.Next() {
+		var pid int
+		var ok bool
+		if err := rows.Scan(&pid, &ok); err != nil {
+			return nil, err
+		}
+		if ok {
+			terminated = append(terminated, pid)
+		}
+	}
+
+	return terminated, rows.Err()
+}
+
+// Utilization is a snapshot of the client backends of the server.
+type Utilization struct {
+	// Total is the number of client backends of the server, whatever their user and database.
+	Total             int
+	Active            int
+	Idle              int
+	IdleInTransaction int
+	// Own is the number of client backends of the user and the database of the connection.
+	Own int
+	// Reserved is the number of slots reserved to superusers.
+	Reserved int
+	// Pending is the number of connections SlsPool may still open on top of the current ones.
+	Pending int
+	// Limit is the number of connections available to non superusers, or MaxConnections
+	// when ManualMaxConnections is set.
+	Limit int
+}
+
+func (c cleaner) utilization(ctx context.Context) (Utilization, error) {
+	query := `
+	SELECT
+	  COUNT(pid),
+	  COUNT(pid) FILTER (WHERE state = 'active'),
+	  COUNT(pid) FILTER (WHERE state = 'idle'),
+	  COUNT(pid) FILTER (WHERE state IN ('idle in transaction', 'idle in transaction (aborted)')),
+	  COUNT(pid) FILTER (WHERE datname = $1 AND usename = $2),
+	  current_setting('superuser_reserved_connections')::int
+    FROM pg_stat_activity
+    WHERE backend_type = 'client backend';`
+	u := Utilization{Pending: c.pending}
+
+	err := c.db.QueryRow(
+		ctx,
+		query,
+		c.connCred.database,
+		c.connCred.user,
+	).Scan(&u.Total, &u.Active, &u.Idle, &u.IdleInTransaction, &u.Own, &u.Reserved)
+
+	if err != nil {
+		return Utilization{}, err
+	}
+
+	u.Limit, err = c.getMaxConnections(ctx)
+	if err != nil {
+		return Utilization{}, err
+	}
+
+	return u, nil
+}
+
+// clean terminates the idle connections when the server is above the threshold, unless dryRun is set,
+// in which case the candidates are only returned.
+func (c cleaner) clean(ctx context.Context, dryRun bool) (CleanResult, error) {
+	start := time.Now()
+	result := CleanResult{DryRun: dryRun}
+	u, err := c.utilization(ctx)
+	if err != nil {
+		return result, err
+	}
+	c.logger.Info(fmt.Sprintf("Utilization: %+v", u))
+
+	result.Utilization = u
+	result.Threshold = float32(u.Limit) * c.config.ConnUtilization
+	if float32(u.Total+u.Pending) > result.Threshold {
+		result.Candidates, err = c.getIdleProcessesListByMinimumTimeout(ctx)
+		if err != nil {
+			return result, err
+		}
+
+		if dryRun {
+			c.logger.Info(fmt.Sprintf("Dry run, processes to kill: %v", len(result.Candidates)))
+			result.Elapsed = time.Since(start)
+			return result, nil
+		}
+
+		pidLst := make([]int, 0)
+		for _, candidate := range result.Candidates {
+			pidLst = append(pidLst, candidate.Pid)
+		}
+		result.Terminated, err = c.killProcesses(ctx, pidLst)
+		if err != nil {
+			return result, err
+		}
+		result.Failed = failedPids(pidLst, result.Terminated)
+
+		c.logger.Info(fmt.Sprintf("Killed processes: %v, failed: %v", len(result.Terminated), len(result.Failed)))
+	}
+	result.Elapsed = time.Since(start)
+
+	return result, nil
+}
+
+// failedPids returns the pids that have not been terminated.
+func failedPids(pids []int, terminated []int) []int {
+	isTerminated := make(map[int]bool, len(terminated))
+	for _, pid := range terminated {
+		isTerminated[pid] = true
+	}
+
+	failed := make([]int, 0)
+	for _, pid := range pids {
+		if !isTerminated[pid] {
+			failed = append(failed, pid)
+		}
+	}
+
+	return failed
+}
@@ -0,0 +1,158 @@
+package slsPgx
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeQuerier answers every QueryRow with value and counts the queries.
+type fakeQuerier struct {
+	value   int
+	queries int32
+}
+
+func (q *fakeQuerier) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (q *fakeQuerier) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	atomic.AddInt32(&q.queries, 1)
+	return fakeRow{value: q.value}
+}
+
+func (q *fakeQuerier) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return nil, errors.New("not implemented")
+}
+
+type fakeRow struct {
+	value int
+}
+
+func (r fakeRow) Scan(dest ...interface{}) error {
+	*dest[0].(*int) = r.value
+	return nil
+}
+
+func Test_failedPids(t *testing.T) {
+	tests := []struct {
+		name       string
+		pids       []int
+		terminated []int
+		want       []int
+	}{
+		{
+			name:       "Should return no pid when all have been terminated",
+			pids:       []int{1, 2, 3},
+			terminated: []int{3, 1, 2},
+			want:       []int{},
+		},
+		{
+			name:       "Should return the pids that have not been terminated",
+			pids:       []int{1, 2, 3},
+			terminated: []int{2},
+			want:       []int{1, 3},
+		},
+		{
+			name:       "Should return all the pids when none has been terminated",
+			pids:       []int{1, 2},
+			terminated: []int{},
+			want:       []int{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := failedPids(tt.pids, tt.terminated); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("failedPids() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_cleaner_getMaxConnections_concurrent(t *testing.T) {
+	db := &fakeQuerier{value: 97}
+	c := cleaner{
+		db:             db,
+		config:         newDefaultConfig(),
+		logger:         newLogger(false),
+		maxConnections: &maxConnections{},
+		clock:          realClock{},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := c.getMaxConnections(context.Background())
+			if err != nil || got != 97 {
+				t.Errorf("getMaxConnections() got = %v, %v, want 97", got, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if db.queries != 1 {
+		t.Errorf("getMaxConnections() queries = %v, want 1", db.queries)
+	}
+}
+
+func Test_cleaner_getMaxConnections_expiry(t *testing.T) {
+	tests := []struct {
+		name        string
+		freqMs      float32
+		advance     time.Duration
+		wantQueries int32
+	}{
+		{
+			name:        "Should use the cached max connections before MaxConnectionsFreqMs has elapsed",
+			freqMs:      60000,
+			advance:     59 * time.Second,
+			wantQueries: 1,
+		},
+		{
+			name:        "Should fetch the max connections again once MaxConnectionsFreqMs has elapsed",
+			freqMs:      60000,
+			advance:     60 * time.Second,
+			wantQueries: 2,
+		},
+		{
+			name:        "Should always fetch the max connections when MaxConnectionsFreqMs is 0",
+			freqMs:      0,
+			wantQueries: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeQuerier{value: 97}
+			clock := &fakeClock{now: time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)}
+			config := newDefaultConfig()
+			config.MaxConnectionsFreqMs = tt.freqMs
+			c := cleaner{
+				db:             db,
+				config:         config,
+				logger:         newLogger(false),
+				maxConnections: &maxConnections{},
+				clock:          clock,
+			}
+
+			if _, err := c.getMaxConnections(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			clock.now = clock.now.Add(tt.advance)
+			got, err := c.getMaxConnections(context.Background())
+			if err != nil || got != 97 {
+				t.Errorf("getMaxConnections() got = %v, %v, want 97", got, err)
+			}
+			if db.queries != tt.wantQueries {
+				t.Errorf("getMaxConnections() queries = %v, want %v", db.queries, tt.wantQueries)
+			}
+		})
+	}
+}
@@ -14,6 +14,20 @@ type slsConnConfig struct {
 	BackoffBaseMs            float32
 	BackoffDelayMs           float32
 	BackoffMaxRetries        int
+	BackoffStrategy          string
+	CustomBackoffStrategy    BackoffStrategy // this can be nil
+	DeadlineReserveMs        float32
+	RandSeed                 *int64              // this can be nil
+	Clock                    Clock               // this can be nil
+	PasswordProvider         PasswordProvider    // this can be nil
+	CredentialsProvider      CredentialsProvider // this can be nil
+	CredentialsTTLMs         float32
+	RouteQueriesToReader     bool
+	ExcludeApplicationNames  []string // this can be nil
+	ExcludeClientAddrs       []string // this can be nil
+	ExcludePids              []int    // this can be nil
+	ApplicationNamePrefix    string
+	CleanOwnApplicationOnly  bool
 }
 
 type SlsConnConfigParams struct {
@@ -28,6 +42,45 @@ type SlsConnConfigParams struct {
 	BackoffBaseMs            *float32
 	BackoffDelayMs           *float32
 	BackoffMaxRetries        *int
+	// BackoffStrategy is one of BackoffFullJitter, BackoffEqualJitter, BackoffDecorrelatedJitter,
+	// BackoffExponential or BackoffConstant, BackoffDecorrelatedJitter is the default.
+	BackoffStrategy *string
+	// CustomBackoffStrategy, when set, computes the delays between retries in place of BackoffStrategy.
+	CustomBackoffStrategy BackoffStrategy
+	// DeadlineReserveMs is the time left before the context deadline, e.g. the Lambda invocation deadline,
+	// that retries never consume, so there is still time to respond once they give up.
+	DeadlineReserveMs *float32
+	// RandSeed seeds the random delays of the backoff, making them reproducible.
+	RandSeed *int64
+	// Clock replaces the time package in the backoff, e.g. to run it in tests without waiting.
+	Clock Clock
+	// PasswordProvider, when set, replaces the password of the connection config on every connect,
+	// see RDSIAMTokenProvider. SlsPool does not support it and fails to connect when it is set.
+	PasswordProvider PasswordProvider
+	// CredentialsProvider, when set, replaces the user and the password of the connection config.
+	// The credentials are cached for CredentialsTTLMs and, when the server rejects them, fetched again
+	// and used for one more attempt. It cannot be used together with PasswordProvider.
+	// SlsPool does not support it and fails to connect when it is set.
+	CredentialsProvider CredentialsProvider
+	CredentialsTTLMs    *float32
+	// RouteQueriesToReader runs Query on the reader of SlsConn.ConnectConfigs, if any.
+	// Query must then only be used for statements that do not write.
+	RouteQueriesToReader *bool
+	// ExcludeApplicationNames are LIKE patterns, e.g. "psql%", of the application_name of the
+	// connections Clean must never terminate.
+	ExcludeApplicationNames []string
+	// ExcludeClientAddrs are the client addresses, e.g. "10.0.0.12", of the connections Clean must never terminate.
+	ExcludeClientAddrs []string
+	// ExcludePids are the pids of the connections Clean must never terminate.
+	ExcludePids []int
+	// ApplicationNamePrefix identifies the connections, their application_name is set to the prefix
+	// followed by the instance id, e.g. slspgx:my-function:1a2b3c4d. It is slspgx:<AWS_LAMBDA_FUNCTION_NAME>
+	// by default, unless application_name is set in the connection config, which is then kept as it is.
+	ApplicationNamePrefix *string
+	// CleanOwnApplicationOnly makes Clean terminate only the connections whose application_name starts
+	// with ApplicationNamePrefix followed by ':', or is the prefix itself, so services sharing the same
+	// user do not evict each other, e.g. with the prefix orders the connections of orders-v2 are left alone.
+	CleanOwnApplicationOnly *bool
 }
 
 func newDefaultConfig() slsConnConfig {
@@ -43,6 +96,8 @@ func newDefaultConfig() slsConnConfig {
 		BackoffBaseMs:            2,
 		BackoffDelayMs:           1000,
 		BackoffMaxRetries:        3,
+		BackoffStrategy:          BackoffDecorrelatedJitter,
+		CredentialsTTLMs:         300000,
 	}
 }
 
@@ -104,6 +159,60 @@ func (s *slsConnConfig) mergeAndValidate(c SlsConnConfigParams) error {
 		}
 		s.BackoffDelayMs = *c.BackoffDelayMs
 	}
+	if c.BackoffStrategy != nil {
+		if err := s.validateBackoffStrategy(*c.BackoffStrategy); err != nil {
+			return err
+		}
+		s.BackoffStrategy = *c.BackoffStrategy
+	}
+	if c.CustomBackoffStrategy != nil {
+		s.CustomBackoffStrategy = c.CustomBackoffStrategy
+	}
+	if c.DeadlineReserveMs != nil {
+		if err := s.validateFloat("DeadlineReserveMs", *c.DeadlineReserveMs); err != nil {
+			return err
+		}
+		s.DeadlineReserveMs = *c.DeadlineReserveMs
+	}
+	if c.RandSeed != nil {
+		s.RandSeed = c.RandSeed
+	}
+	if c.Clock != nil {
+		s.Clock = c.Clock
+	}
+	if c.PasswordProvider != nil {
+		s.PasswordProvider = c.PasswordProvider
+	}
+	if c.CredentialsProvider != nil {
+		if c.PasswordProvider != nil {
+			return errors.New("PasswordProvider and CredentialsProvider cannot be used together")
+		}
+		s.CredentialsProvider = c.CredentialsProvider
+	}
+	if c.CredentialsTTLMs != nil {
+		if err := s.validateFloat("CredentialsTTLMs", *c.CredentialsTTLMs); err != nil {
+			return err
+		}
+		s.CredentialsTTLMs = *c.CredentialsTTLMs
+	}
+	if c.RouteQueriesToReader != nil {
+		s.RouteQueriesToReader = *c.RouteQueriesToReader
+	}
+	if c.ExcludeApplicationNames != nil {
+		s.ExcludeApplicationNames = c.ExcludeApplicationNames
+	}
+	if c.ExcludeClientAddrs != nil {
+		s.ExcludeClientAddrs = c.ExcludeClientAddrs
+	}
+	if c.ExcludePids != nil {
+		s.ExcludePids = c.ExcludePids
+	}
+	if c.ApplicationNamePrefix != nil {
+		s.ApplicationNamePrefix = *c.ApplicationNamePrefix
+	}
+	if c.CleanOwnApplicationOnly != nil {
+		s.CleanOwnApplicationOnly = *c.CleanOwnApplicationOnly
+	}
 	if c.ManualMaxConnections != nil {
 		s.ManualMaxConnections = *c.ManualMaxConnections
 	}
@@ -138,3 +247,12 @@ func (s slsConnConfig) validateConnectionsUtilization(value float32) error {
 
 	return nil
 }
+
+func (s slsConnConfig) validateBackoffStrategy(value string) error {
+	switch value {
+	case BackoffFullJitter, BackoffEqualJitter, BackoffDecorrelatedJitter, BackoffExponential, BackoffConstant:
+		return nil
+	}
+
+	return errors.New("backoffStrategy " + value + " is not supported")
+}
@@ -31,6 +31,8 @@ func Test_slsConnConfig_merge(t *testing.T) {
 				BackoffBaseMs:            2,
 				BackoffDelayMs:           1000,
 				BackoffMaxRetries:        3,
+				BackoffStrategy:          BackoffDecorrelatedJitter,
+				CredentialsTTLMs:         300000,
 			},
 		},
 		{
@@ -50,6 +52,8 @@ func Test_slsConnConfig_merge(t *testing.T) {
 				BackoffBaseMs:            2,
 				BackoffDelayMs:           1000,
 				BackoffMaxRetries:        3,
+				BackoffStrategy:          BackoffDecorrelatedJitter,
+				CredentialsTTLMs:         300000,
 			},
 		},
 		{
@@ -69,6 +73,8 @@ func Test_slsConnConfig_merge(t *testing.T) {
 				BackoffBaseMs:            2,
 				BackoffDelayMs:           1000,
 				BackoffMaxRetries:        3,
+				BackoffStrategy:          BackoffDecorrelatedJitter,
+				CredentialsTTLMs:         300000,
 			},
 		},
 		{
@@ -88,6 +94,58 @@ func Test_slsConnConfig_merge(t *testing.T) {
 				BackoffBaseMs:            2,
 				BackoffDelayMs:           1000,
 				BackoffMaxRetries:        3,
+				BackoffStrategy:          BackoffDecorrelatedJitter,
+				CredentialsTTLMs:         300000,
+			},
+		},
+		{
+			name: "Should correctly mergeAndValidate the config and set the exclusions of Clean",
+			args: args{c: SlsConnConfigParams{
+				ExcludeApplicationNames: []string{"psql%", "migrate"},
+				ExcludeClientAddrs:      []string{"10.0.0.12"},
+				ExcludePids:             []int{42},
+			}},
+			want: slsConnConfig{
+				MaxConnectionsFreqMs:     60000,
+				ManualMaxConnections:     false,
+				MaxConnections:           100,
+				MinConnectionIdleTimeSec: 0.5,
+				MaxIdleConnectionsToKill: nil,
+				ConnUtilization:          0.8,
+				Debug:                    false,
+				BackoffCapMs:             1000,
+				BackoffBaseMs:            2,
+				BackoffDelayMs:           1000,
+				BackoffMaxRetries:        3,
+				BackoffStrategy:          BackoffDecorrelatedJitter,
+				CredentialsTTLMs:         300000,
+				ExcludeApplicationNames:  []string{"psql%", "migrate"},
+				ExcludeClientAddrs:       []string{"10.0.0.12"},
+				ExcludePids:              []int{42},
+			},
+		},
+		{
+			name: "Should correctly mergeAndValidate the config and set the application name",
+			args: args{c: SlsConnConfigParams{
+				ApplicationNamePrefix:   String("orders"),
+				CleanOwnApplicationOnly: Bool(true),
+			}},
+			want: slsConnConfig{
+				MaxConnectionsFreqMs:     60000,
+				ManualMaxConnections:     false,
+				MaxConnections:           100,
+				MinConnectionIdleTimeSec: 0.5,
+				MaxIdleConnectionsToKill: nil,
+				ConnUtilization:          0.8,
+				Debug:                    false,
+				BackoffCapMs:             1000,
+				BackoffBaseMs:            2,
+				BackoffDelayMs:           1000,
+				BackoffMaxRetries:        3,
+				BackoffStrategy:          BackoffDecorrelatedJitter,
+				CredentialsTTLMs:         300000,
+				ApplicationNamePrefix:    "orders",
+				CleanOwnApplicationOnly:  true,
 			},
 		},
 	}
@@ -140,6 +198,28 @@ func Test_slsConnConfig_validation(t *testing.T) {
 			}},
 			want: "connectionsUtilization should not be negative",
 		},
+		{
+			name: "Should reject DeadlineReserveMs, is less than 0",
+			args: args{c: SlsConnConfigParams{
+				DeadlineReserveMs: Float32(-1),
+			}},
+			want: "DeadlineReserveMs should not be negative",
+		},
+		{
+			name: "Should reject BackoffStrategy, is not supported",
+			args: args{c: SlsConnConfigParams{
+				BackoffStrategy: String("linear"),
+			}},
+			want: "backoffStrategy linear is not supported",
+		},
+		{
+			name: "Should reject PasswordProvider and CredentialsProvider together",
+			args: args{c: SlsConnConfigParams{
+				PasswordProvider:    &RDSIAMTokenProvider{},
+				CredentialsProvider: EnvCredentialsProvider{},
+			}},
+			want: "PasswordProvider and CredentialsProvider cannot be used together",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
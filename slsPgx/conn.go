@@ -2,24 +2,35 @@ package slsPgx
 
 import (
 	"context"
-	"errors"
-	"fmt"
 	"github.com/jackc/pgconn"
-	"github.com/jackc/pgtype"
 	"github.com/jackc/pgx/v4"
-	"net/url"
-	"reflect"
-	"strings"
+	"sync"
 	"time"
 )
 
+// pgxConnectConfig opens the connections of SlsConn, tests replace it to simulate the server.
+var pgxConnectConfig = pgx.ConnectConfig
+
+// SlsConn is safe for concurrent use, calls are serialized on its single connection.
+// While rows returned by Query or batch results returned by SendBatch are open the connection
+// is held, they must be closed before SlsConn can be used again, also from the same goroutine.
 type SlsConn struct {
-	config     slsConnConfig
-	delay      delay
-	tempConfig SlsConnConfigParams
-	conn       *pgx.Conn
-	logger     Logger
-	connCred   connCred
+	mu           sync.Mutex
+	config       slsConnConfig
+	delay        delay
+	tempConfig   SlsConnConfigParams
+	conn         *pgx.Conn
+	connConfig   *pgx.ConnConfig
+	reader       *pgx.Conn
+	readerConfig *pgx.ConnConfig
+	failover     bool
+	credentials  *credentialsCache
+	logger       Logger
+	connCred     connCred
+
+	maxConnections maxConnections
+	// prefix of the application_name of the connections
+	applicationNamePrefix string
 }
 
 func New(config SlsConnConfigParams) *SlsConn {
@@ -28,74 +39,92 @@ func New(config SlsConnConfigParams) *SlsConn {
 	}
 }
 
-func (s *SlsConn) parseURL(connString string) error {
-	parse, err := url.Parse(connString)
-	if err != nil {
-		return err
-	}
-
-	s.connCred.user = parse.User.Username()
-	s.connCred.database = strings.Replace(parse.Path, "/", "", 2)
-
-	return nil
-}
-
 func (s *SlsConn) Connect(ctx context.Context, connectionString string) error {
 	config, err := pgx.ParseConfig(connectionString)
 	if err != nil {
 		return err
 	}
 
-	return s.connect(ctx, config)
+	return s.connect(ctx, config, nil, false)
 }
 
 func (s *SlsConn) ConnectConfig(ctx context.Context, connConfig *pgx.ConnConfig) error {
-	return s.connect(ctx, connConfig)
+	return s.connect(ctx, connConfig, nil, false)
+}
+
+// ConnectConfigs connects to the writer and, if not nil, to the reader, e.g. the cluster and the reader
+// endpoints of Aurora. Only a read-write instance is accepted as the writer: during a failover, when
+// the writer is reached on an instance that is read-only or a statement fails because it has become
+// read-only, the writer connection is opened again with backoff until the new writer is reached.
+// Set RouteQueriesToReader to run Query on the reader.
+func (s *SlsConn) ConnectConfigs(ctx context.Context, writer *pgx.ConnConfig, reader *pgx.ConnConfig) error {
+	return s.connect(ctx, writer, reader, true)
 }
 
-func (s *SlsConn) connect(ctx context.Context, connConfig *pgx.ConnConfig) error {
+func (s *SlsConn) connect(ctx context.Context, connConfig *pgx.ConnConfig, readerConfig *pgx.ConnConfig, failover bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.config = newDefaultConfig()
 	if err := s.config.mergeAndValidate(s.tempConfig); err != nil {
 		return err
 	}
 
-	if err := s.parseURL(connConfig.ConnString()); err != nil {
-		return err
-	}
-
 	s.logger = newLogger(s.config.Debug)
 	s.delay = newDelay(delayConfig{
 		backoffCapMs:   s.config.BackoffCapMs,
 		backoffBaseMs:  s.config.BackoffBaseMs,
 		backoffDelayMs: s.config.BackoffDelayMs,
+		strategy:       s.config.BackoffStrategy,
+		custom:         s.config.CustomBackoffStrategy,
+		randSeed:       s.config.RandSeed,
+		clock:          s.config.Clock,
 	})
 
-	// If the client is already connected do not reconnect
+	// If the client is already connected do not reconnect, only open the reader if it failed to
 	if s.conn != nil {
+		if s.readerConfig != nil && s.reader == nil {
+			return s.openReader(ctx)
+		}
 		return nil
 	}
 
-	for i := 1; i < s.config.BackoffMaxRetries+1; i++ {
-		conn, err := pgx.ConnectConfig(ctx, connConfig)
-		if err != nil {
-			if containsError(connectionErrors, err) {
-				delay := s.delay.getDelay()
-				time.Sleep(delay)
-				s.logger.Info(fmt.Sprintf("Retry attempt: %v with delay: %v", i, delay))
+	// Keep a copy of the config, also the settings that cannot be expressed in the connection string
+	// must be used when reconnecting
+	s.connConfig = connConfig.Copy()
+	s.connCred = newConnCred(&s.connConfig.Config)
+	name, prefix := applicationName(s.config, s.connConfig.RuntimeParams)
+	setApplicationName(&s.connConfig.Config, name)
+	s.applicationNamePrefix = prefix
+	s.failover = failover
+	if failover {
+		s.connConfig.ValidateConnect = validateReadWrite(s.connConfig.ValidateConnect)
+	}
+	if readerConfig != nil {
+		s.readerConfig = readerConfig.Copy()
+		setApplicationName(&s.readerConfig.Config, name)
+	}
+	if s.config.CredentialsProvider != nil {
+		ttl := time.Duration(s.config.CredentialsTTLMs) * time.Millisecond
+		s.credentials = newCredentialsCache(s.config.CredentialsProvider, ttl, s.delay.clock)
+	}
 
-				if i == s.config.BackoffMaxRetries {
-					return err
-				}
+	if err := s.open(ctx, &s.conn, s.connConfig, "Retry connection"); err != nil {
+		return err
+	}
+	if s.readerConfig != nil {
+		return s.openReader(ctx)
+	}
 
-				continue
-			}
+	s.logger.Info("Connected")
 
-			return err
-		}
+	return nil
+}
 
-		s.conn = conn
-		s.connCred.url = connConfig.ConnString()
-		break
+// openReader opens the reader connection, it is opened again by the next connect when it fails.
+func (s *SlsConn) openReader(ctx context.Context) error {
+	if err := s.open(ctx, &s.reader, s.readerConfig, "Retry reader connection"); err != nil {
+		return err
 	}
 
 	s.logger.Info("Connected")
@@ -103,191 +132,326 @@ func (s *SlsConn) connect(ctx context.Context, connConfig *pgx.ConnConfig) error
 	return nil
 }
 
-func (s *SlsConn) getIdleProcessesListByMinimumTimeout(ctx context.Context) ([]statActivity, error) {
-	query := `
-    WITH processes AS(
-      SELECT
-         EXTRACT(EPOCH FROM (Now() - state_change)) AS idle_time,
-         pid
-      FROM pg_stat_activity
-      WHERE usename=$1
-        AND datname=$2
-        AND state='idle'
-    )
-    SELECT pid
-    FROM processes
-    WHERE idle_time > $3
-    LIMIT $4;`
-
-	rows, err := s.conn.Query(
-		ctx,
-		query,
-		s.connCred.user,
-		s.connCred.database,
-		s.config.MinConnectionIdleTimeSec,
-		s.config.MaxIdleConnectionsToKill,
-	)
+// open sets conn to a new connection opened with connConfig, retrying with backoff.
+func (s *SlsConn) open(ctx context.Context, conn **pgx.Conn, connConfig *pgx.ConnConfig, action string) error {
+	connectCtx, cancel := withBudget(ctx, s.config)
+	defer cancel()
 
-	if err != nil {
-		return nil, err
+	return backoff(ctx, s.config, s.delay, s.logger, action, func() (bool, error) {
+		c, err := s.dial(connectCtx, connConfig)
+		if err != nil {
+			return isConnectionError(err), err
+		}
+
+		*conn = c
+
+		return false, nil
+	})
+}
+
+func (s *SlsConn) cleaner() cleaner {
+	c := cleaner{
+		db:             s.conn,
+		config:         s.config,
+		connCred:       s.connCred,
+		logger:         s.logger,
+		maxConnections: &s.maxConnections,
+		clock:          s.delay.clock,
+	}
+	if s.config.CleanOwnApplicationOnly {
+		c.applicationNamePrefix = s.applicationNamePrefix
 	}
 
-	defer rows.Close()
+	return c
+}
 
-	stats := make([]statActivity, 0)
+func (s *SlsConn) Clean(ctx context.Context) (CleanResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	for rows.Next() {
-		var stat statActivity
-		if err := rows.Scan(&stat.pid); err != nil {
-			return nil, err
-		}
+	return s.cleaner().clean(ctx, false)
+}
+
+// CleanDryRun works like Clean but does not terminate the idle connections,
+// it returns them as the candidates Clean would terminate.
+func (s *SlsConn) CleanDryRun(ctx context.Context) (CleanResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.cleaner().clean(ctx, true)
+}
+
+// Utilization returns a snapshot of the client backends of the server, Clean terminates idle connections
+// when Total is above ConnUtilization of Limit.
+func (s *SlsConn) Utilization(ctx context.Context) (Utilization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		stats = append(stats, stat)
+	return s.cleaner().utilization(ctx)
+}
+
+// GetConnection returns the current connection, it can be replaced at any time by a reconnection
+// and it must not be used concurrently with SlsConn.
+func (s *SlsConn) GetConnection() *pgx.Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.conn
+}
+
+func (s *SlsConn) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.conn.Close(ctx)
+	if s.reader != nil {
+		if readerErr := s.reader.Close(ctx); err == nil {
+			err = readerErr
+		}
 	}
 
-	return stats, nil
+	return err
 }
 
-func (s *SlsConn) killProcesses(ctx context.Context, pids []int) error {
-	query := `
-	SELECT pg_terminate_backend(pid)
-    FROM pg_stat_activity
-    WHERE pid = ANY ($1) AND state='idle'`
+// Query works like pgx.Conn.Query, the connection is held until the returned rows are closed.
+// The query is retried until its first row has been read, see readFirstRow.
+// It runs on the reader when RouteQueriesToReader is set and SlsConn has been connected with a reader.
+func (s *SlsConn) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	s.mu.Lock()
 
-	ids := &pgtype.Int4Array{}
-	if err := ids.Set(pids); err != nil {
-		return err
+	retry := s.retry
+	if s.config.RouteQueriesToReader && s.readerConfig != nil {
+		retry = s.retryReader
 	}
 
-	if _, err := s.conn.Exec(ctx, query, ids); err != nil {
+	var rows pgx.Rows
+	err := retry(ctx, func(conn *pgx.Conn) error {
+		var err error
+		rows, err = readFirstRow(conn.Query(ctx, sql, args...))
 		return err
+	})
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
 	}
 
-	return nil
+	return &slsRows{Rows: rows, release: s.releaseFunc()}, nil
 }
 
-func (s SlsConn) getProcessCount(ctx context.Context) (uint8, error) {
-	query := `
-	SELECT COUNT(pid)
-    FROM pg_stat_activity
-    WHERE datname=$1
-      AND usename=$2;`
-	var count uint8
+// releaseFunc returns a function that unlocks s only the first time it is called.
+func (s *SlsConn) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(s.mu.Unlock)
+	}
+}
 
-	err := s.conn.QueryRow(
-		ctx,
-		query,
-		s.connCred.database,
-		s.connCred.user,
-	).Scan(&count)
+// slsRows releases the connection once the rows are closed, pgx closes them
+// automatically when Next returns false.
+type slsRows struct {
+	pgx.Rows
+	release func()
+}
 
-	if err != nil {
-		return 0, err
+func (r *slsRows) Next() bool {
+	if r.Rows.Next() {
+		return true
 	}
 
-	return count, nil
+	r.release()
+
+	return false
+}
+
+func (r *slsRows) Close() {
+	r.Rows.Close()
+	r.release()
 }
 
-func (s *SlsConn) Clean(ctx context.Context) (int, error) {
-	var processList []statActivity
-	count, err := s.getProcessCount(ctx)
+// readFirstRow reads the first row of rows. pgx does not read anything when it sends a prepared
+// statement, so the error of a terminated backend is only reported through the rows: reading the
+// first row returns it while the query can still be retried. Errors after the first row are not retried.
+func readFirstRow(rows pgx.Rows, err error) (pgx.Rows, error) {
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	s.logger.Info(fmt.Sprintf("Total processes: %v", count))
 
-	if float32(count) > float32(s.config.MaxConnections)*s.config.ConnUtilization {
-		processList, err = s.getIdleProcessesListByMinimumTimeout(ctx)
-		if err != nil {
-			return 0, err
-		}
+	first := rows.Next()
+	if !first && rows.Err() != nil {
+		return nil, rows.Err()
+	}
 
-		pidLst := make([]int, 0)
-		for _, activity := range processList {
-			pidLst = append(pidLst, activity.pid)
-		}
-		if err := s.killProcesses(ctx, pidLst); err != nil {
-			return 0, err
-		}
+	return &firstRowRows{Rows: rows, pending: true, first: first}, nil
+}
 
-		s.logger.Info(fmt.Sprintf("Killed processes: %v", len(processList)))
+// firstRowRows returns the row already read by readFirstRow on the first call to Next.
+type firstRowRows struct {
+	pgx.Rows
+	pending bool
+	first   bool
+}
+
+func (r *firstRowRows) Next() bool {
+	if r.pending {
+		r.pending = false
+		return r.first
 	}
 
-	return len(processList), nil
+	return r.Rows.Next()
 }
 
-func (s SlsConn) GetConnection() *pgx.Conn {
-	return s.conn
+// QueryRow works like pgx.Conn.QueryRow, the query is executed when Scan is called
+// and it is retried on a new connection if the backend has been terminated.
+func (s *SlsConn) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return &slsRow{
+		s:    s,
+		ctx:  ctx,
+		sql:  sql,
+		args: args,
+	}
 }
 
-func (s SlsConn) Close(ctx context.Context) error {
-	return s.conn.Close(ctx)
+type slsRow struct {
+	s    *SlsConn
+	ctx  context.Context
+	sql  string
+	args []interface{}
 }
 
-func (s SlsConn) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
-	res, err := s.retry(ctx, "Query", sql, args...)
+func (r *slsRow) Scan(dest ...interface{}) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.retry(r.ctx, func(conn *pgx.Conn) error {
+		return conn.QueryRow(r.ctx, r.sql, r.args...).Scan(dest...)
+	})
+}
+
+// WithTx runs fn inside a transaction and commits it if fn returns no error.
+// The whole transaction is re-run from scratch, on a new connection if needed, when the
+// backend has been terminated or the transaction failed with a serialization failure or a deadlock,
+// fn must therefore be safe to be called more than once and it must use only the given transaction,
+// not s, which is held until the transaction ends.
+func (s *SlsConn) WithTx(ctx context.Context, txOptions pgx.TxOptions, fn func(pgx.Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.retry(ctx, func(conn *pgx.Conn) error {
+		return runTx(ctx, conn, txOptions, fn)
+	}, txErrorCodes...)
+}
+
+func runTx(ctx context.Context, conn *pgx.Conn, txOptions pgx.TxOptions, fn func(pgx.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, txOptions)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	rows, ok := res.Interface().(pgx.Rows)
-	if !ok {
-		return nil, errors.New("type mismatch, should be of type pgx.Rows")
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback(ctx)
+		return err
 	}
 
-	return rows, nil
+	return tx.Commit(ctx)
 }
 
-func (s SlsConn) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
-	res, err := s.retry(ctx, "Exec", sql, args...)
+func (s *SlsConn) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var commandTag pgconn.CommandTag
+	err := s.retry(ctx, func(conn *pgx.Conn) error {
+		var err error
+		commandTag, err = conn.Exec(ctx, sql, args...)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	commandTag, ok := res.Interface().(pgconn.CommandTag)
-	if !ok {
-		return nil, errors.New("type mismatch, should be of type pgx.CommandTag")
-	}
-
 	return commandTag, nil
 }
 
-// Re-usable method to retry any pgx method
-func (s SlsConn) retry(ctx context.Context, function string, sql string, args ...interface{}) (reflect.Value, error) {
-	var res reflect.Value
-	for i := 1; i < s.config.BackoffMaxRetries+1; i++ {
-		allArgs := []interface{}{ctx, sql}
-		allArgs = append(allArgs, args...)
-		out, err := callFuncByName(s.conn, function, allArgs...)
-		if err != nil {
-			if containsError(queryErrors, err) {
-				delay := s.delay.getDelay()
-				time.Sleep(delay)
+// retry runs fn with the current connection and runs it again if the backend has been terminated,
+// in which case it reconnects first, or if fn fails with one of the given SQLSTATE codes.
+// A connection that has already been closed, e.g. by a previous fatal error, is replaced before running fn.
+// s.mu must be held by the caller.
+func (s *SlsConn) retry(ctx context.Context, fn func(conn *pgx.Conn) error, retryCodes ...string) error {
+	return s.retryOn(ctx, &s.conn, s.connConfig, s.failover, fn, retryCodes...)
+}
 
-				conn, err := pgx.Connect(ctx, s.connCred.url)
-				if err != nil {
-					if containsError(connectionErrors, err) {
-						continue
-					}
+// retryReader works like retry on the reader connection.
+func (s *SlsConn) retryReader(ctx context.Context, fn func(conn *pgx.Conn) error, retryCodes ...string) error {
+	return s.retryOn(ctx, &s.reader, s.readerConfig, false, fn, retryCodes...)
+}
 
-					return reflect.Value{}, err
-				}
+// retryOn works like retry on conn, which is opened again with connConfig. When failover is set
+// a read-only error on an instance in recovery means that it is no longer the writer and conn is opened again.
+func (s *SlsConn) retryOn(ctx context.Context, conn **pgx.Conn, connConfig *pgx.ConnConfig, failover bool, fn func(conn *pgx.Conn) error, retryCodes ...string) error {
+	terminated := false
+	return backoff(ctx, s.config, s.delay, s.logger, "Retry query", func() (bool, error) {
+		if terminated || (*conn != nil && (*conn).IsClosed()) {
+			if err := s.reconnect(ctx, conn, connConfig); err != nil {
+				return isConnectionError(err), &reconnectError{err: err}
+			}
+			terminated = false
+		}
 
-				s.conn = conn
-				s.logger.Info(fmt.Sprintf("Retry query...Retry attempt: %v with delay: %v", i, delay))
+		err := fn(*conn)
+		if err == nil {
+			return false, nil
+		}
 
-				if i == s.config.BackoffMaxRetries {
-					return reflect.Value{}, err
-				}
+		terminated = isTerminatedError(err) || (failover && isFailoverError(ctx, *conn, err))
+		return terminated || containsCode(retryCodes, err), err
+	})
+}
 
-				continue
-			}
+func (s *SlsConn) reconnect(ctx context.Context, conn **pgx.Conn, connConfig *pgx.ConnConfig) error {
+	ctx, cancel := withBudget(ctx, s.config)
+	defer cancel()
 
-			return reflect.Value{}, err
-		}
+	c, err := s.dial(ctx, connConfig)
+	if err != nil {
+		return err
+	}
+
+	if *conn != nil {
+		// the old connection is already broken, closing it only releases its resources
+		_ = (*conn).Close(ctx)
+	}
+	*conn = c
 
-		res = out
-		break
+	return nil
+}
+
+// dial opens a new connection with the current credentials. When the server rejects credentials
+// of the CredentialsProvider they are fetched again, bypassing the cache, and dial tries once more.
+func (s *SlsConn) dial(ctx context.Context, connConfig *pgx.ConnConfig) (*pgx.Conn, error) {
+	if err := s.setCredentials(ctx, connConfig); err != nil {
+		return nil, err
 	}
 
-	return res, nil
+	conn, err := pgxConnectConfig(ctx, connConfig)
+	if err == nil || s.credentials == nil || !containsCode(authErrorCodes, err) {
+		return conn, err
+	}
+
+	s.logger.Failure(err)
+	s.credentials.invalidate()
+	if err := s.setCredentials(ctx, connConfig); err != nil {
+		return nil, err
+	}
+
+	return pgxConnectConfig(ctx, connConfig)
+}
+
+func (s *SlsConn) setCredentials(ctx context.Context, connConfig *pgx.ConnConfig) error {
+	if err := setCredentials(ctx, s.config, s.credentials, connConfig); err != nil {
+		return err
+	}
+	// the user can be changed by the credentials
+	s.connCred.user = newConnCred(&connConfig.Config).user
+
+	return nil
 }
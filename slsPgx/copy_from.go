@@ -0,0 +1,107 @@
+package slsPgx
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrCopyFromSourceConsumed is returned by CopyFrom when the copy has to be retried
+// but some rows were already read from a source that cannot be rewound.
+var ErrCopyFromSourceConsumed = errors.New("copy from source has been partially consumed and cannot be rewound")
+
+// CopyFromRewinder is a pgx.CopyFromSource that can start over from its first row.
+type CopyFromRewinder interface {
+	pgx.CopyFromSource
+	Rewind() error
+}
+
+// CopyFromRows returns a CopyFromRewinder over rows, unlike pgx.CopyFromRows
+// it can be copied again when the copy is retried.
+func CopyFromRows(rows [][]interface{}) CopyFromRewinder {
+	return &copyFromRows{rows: rows, idx: -1}
+}
+
+type copyFromRows struct {
+	rows [][]interface{}
+	idx  int
+}
+
+func (c *copyFromRows) Next() bool {
+	c.idx++
+	return c.idx < len(c.rows)
+}
+
+func (c *copyFromRows) Values() ([]interface{}, error) {
+	return c.rows[c.idx], nil
+}
+
+func (c *copyFromRows) Err() error {
+	return nil
+}
+
+func (c *copyFromRows) Rewind() error {
+	c.idx = -1
+	return nil
+}
+
+// copyFromSource keeps track of whether any row has been read from the wrapped source.
+type copyFromSource struct {
+	pgx.CopyFromSource
+	started bool
+}
+
+func (c *copyFromSource) Next() bool {
+	c.started = true
+	return c.CopyFromSource.Next()
+}
+
+func (c *copyFromSource) rewind() error {
+	if !c.started {
+		return nil
+	}
+
+	rewinder, ok := c.CopyFromSource.(CopyFromRewinder)
+	if !ok {
+		return ErrCopyFromSourceConsumed
+	}
+	c.started = false
+
+	return rewinder.Rewind()
+}
+
+// CopyFrom works like pgx.Conn.CopyFrom and it is retried on a new connection if the backend
+// has been terminated. If rows were already read from rowSrc, the copy is retried only when
+// rowSrc implements CopyFromRewinder, otherwise ErrCopyFromSourceConsumed is returned.
+func (s *SlsConn) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	src := &copyFromSource{CopyFromSource: rowSrc}
+	return s.CopyFromFunc(ctx, tableName, columnNames, func() (pgx.CopyFromSource, error) {
+		if err := src.rewind(); err != nil {
+			return nil, err
+		}
+
+		return src, nil
+	})
+}
+
+// CopyFromFunc works like CopyFrom but newRowSrc is called to get a fresh source before every attempt.
+func (s *SlsConn) CopyFromFunc(ctx context.Context, tableName pgx.Identifier, columnNames []string, newRowSrc func() (pgx.CopyFromSource, error)) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var copied int64
+	err := s.retry(ctx, func(conn *pgx.Conn) error {
+		rowSrc, err := newRowSrc()
+		if err != nil {
+			return err
+		}
+
+		copied, err = conn.CopyFrom(ctx, tableName, columnNames, rowSrc)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return copied, nil
+}
@@ -0,0 +1,145 @@
+package slsPgx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jackc/pgx/v4"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Credentials are the user and the password of the database, an empty User keeps the one of the connection config.
+type Credentials struct {
+	User     string
+	Password string
+}
+
+// CredentialsProvider returns the current credentials of the database, e.g. from a secret store
+// rotating them. SlsConn caches them for CredentialsTTLMs and fetches them again, bypassing the cache,
+// when the server rejects them.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// EnvCredentialsProvider reads the credentials from the environment variables UserKey and PasswordKey,
+// PGUSER and PGPASSWORD when empty.
+type EnvCredentialsProvider struct {
+	UserKey     string
+	PasswordKey string
+}
+
+func (p EnvCredentialsProvider) Credentials(ctx context.Context) (Credentials, error) {
+	userKey, passwordKey := p.UserKey, p.PasswordKey
+	if userKey == "" {
+		userKey = "PGUSER"
+	}
+	if passwordKey == "" {
+		passwordKey = "PGPASSWORD"
+	}
+
+	password, ok := os.LookupEnv(passwordKey)
+	if !ok {
+		return Credentials{}, errors.New(passwordKey + " is not set")
+	}
+
+	return Credentials{User: os.Getenv(userKey), Password: password}, nil
+}
+
+// FileCredentialsProvider reads the credentials from a JSON file in the format of the
+// AWS Secrets Manager database secrets, e.g. {"username": "user", "password": "secret"}.
+type FileCredentialsProvider struct {
+	Path string
+}
+
+func (p FileCredentialsProvider) Credentials(ctx context.Context) (Credentials, error) {
+	content, err := ioutil.ReadFile(p.Path)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	var secret struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.Unmarshal(content, &secret); err != nil {
+		return Credentials{}, err
+	}
+	if secret.Password == "" {
+		return Credentials{}, errors.New("password is missing in " + p.Path)
+	}
+
+	return Credentials{User: secret.Username, Password: secret.Password}, nil
+}
+
+// credentialsCache keeps the credentials of a CredentialsProvider for ttl.
+type credentialsCache struct {
+	mu          sync.Mutex
+	provider    CredentialsProvider
+	ttl         time.Duration
+	clock       Clock
+	credentials Credentials
+	expiresAt   time.Time
+	valid       bool
+}
+
+func newCredentialsCache(provider CredentialsProvider, ttl time.Duration, clock Clock) *credentialsCache {
+	return &credentialsCache{
+		provider: provider,
+		ttl:      ttl,
+		clock:    clock,
+	}
+}
+
+func (c *credentialsCache) get(ctx context.Context) (Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.valid && c.clock.Now().Before(c.expiresAt) {
+		return c.credentials, nil
+	}
+
+	credentials, err := c.provider.Credentials(ctx)
+	if err != nil {
+		return Credentials{}, err
+	}
+	c.credentials = credentials
+	c.expiresAt = c.clock.Now().Add(c.ttl)
+	c.valid = true
+
+	return credentials, nil
+}
+
+func (c *credentialsCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.valid = false
+}
+
+// setCredentials sets the user and the password of connConfig from the cached CredentialsProvider
+// or from the PasswordProvider, if any.
+func setCredentials(ctx context.Context, config slsConnConfig, cache *credentialsCache, connConfig *pgx.ConnConfig) error {
+	if cache != nil {
+		credentials, err := cache.get(ctx)
+		if err != nil {
+			return err
+		}
+		if credentials.User != "" {
+			connConfig.User = credentials.User
+		}
+		connConfig.Password = credentials.Password
+	}
+
+	if config.PasswordProvider != nil {
+		password, err := config.PasswordProvider.Password(ctx)
+		if err != nil {
+			return err
+		}
+		connConfig.Password = password
+	}
+
+	return nil
+}
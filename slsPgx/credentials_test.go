@@ -0,0 +1,194 @@
+package slsPgx
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// rotatingSecretStore hands out its current credentials and counts the fetches,
+// rotate replaces them as a secret store rotating the password would.
+type rotatingSecretStore struct {
+	current Credentials
+	fetches int
+	err     error
+}
+
+func (s *rotatingSecretStore) Credentials(ctx context.Context) (Credentials, error) {
+	s.fetches++
+	if s.err != nil {
+		return Credentials{}, s.err
+	}
+	return s.current, nil
+}
+
+func (s *rotatingSecretStore) rotate(password string) {
+	s.current.Password = password
+}
+
+func Test_credentialsCache(t *testing.T) {
+	storeErr := errors.New("store unavailable")
+	tests := []struct {
+		name        string
+		advance     time.Duration
+		invalidate  bool
+		err         error
+		want        Credentials
+		wantFetches int
+		wantErr     error
+	}{
+		{
+			name:        "Should keep the credentials until they expire",
+			advance:     time.Minute,
+			want:        Credentials{User: "user", Password: "old"},
+			wantFetches: 1,
+		},
+		{
+			name:        "Should fetch the credentials again when they expire",
+			advance:     5 * time.Minute,
+			want:        Credentials{User: "user", Password: "new"},
+			wantFetches: 2,
+		},
+		{
+			name:        "Should fetch the credentials again when they are invalidated",
+			invalidate:  true,
+			want:        Credentials{User: "user", Password: "new"},
+			wantFetches: 2,
+		},
+		{
+			name:        "Should return the error of the provider",
+			invalidate:  true,
+			err:         storeErr,
+			wantFetches: 2,
+			wantErr:     storeErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &rotatingSecretStore{current: Credentials{User: "user", Password: "old"}}
+			clock := &fakeClock{now: time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)}
+			c := newCredentialsCache(store, 5*time.Minute, clock)
+			if _, err := c.get(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			store.rotate("new")
+			store.err = tt.err
+			clock.now = clock.now.Add(tt.advance)
+			if tt.invalidate {
+				c.invalidate()
+			}
+
+			got, err := c.get(context.Background())
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("get() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("get() got = %v, want %v", got, tt.want)
+			}
+			if store.fetches != tt.wantFetches {
+				t.Errorf("get() fetches = %v, want %v", store.fetches, tt.wantFetches)
+			}
+		})
+	}
+}
+
+func TestEnvCredentialsProvider_Credentials(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider EnvCredentialsProvider
+		env      map[string]string
+		want     Credentials
+		wantErr  bool
+	}{
+		{
+			name:     "Should read PGUSER and PGPASSWORD",
+			provider: EnvCredentialsProvider{},
+			env:      map[string]string{"PGUSER": "user", "PGPASSWORD": "secret"},
+			want:     Credentials{User: "user", Password: "secret"},
+			wantErr:  false,
+		},
+		{
+			name:     "Should read the given variables",
+			provider: EnvCredentialsProvider{UserKey: "DB_USER", PasswordKey: "DB_PASSWORD"},
+			env:      map[string]string{"DB_USER": "user", "DB_PASSWORD": "secret"},
+			want:     Credentials{User: "user", Password: "secret"},
+			wantErr:  false,
+		},
+		{
+			name:     "Should fail when the password is not set",
+			provider: EnvCredentialsProvider{PasswordKey: "DB_PASSWORD_NOT_SET"},
+			want:     Credentials{},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				defer func(key, value string) { _ = os.Setenv(key, value) }(key, os.Getenv(key))
+				_ = os.Setenv(key, value)
+			}
+
+			got, err := tt.provider.Credentials(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Credentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Credentials() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileCredentialsProvider_Credentials(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Credentials
+		wantErr bool
+	}{
+		{
+			name:    "Should read a Secrets Manager secret",
+			content: `{"engine": "postgres", "host": "localhost", "username": "user", "password": "secret", "dbname": "postgres", "port": 5432}`,
+			want:    Credentials{User: "user", Password: "secret"},
+			wantErr: false,
+		},
+		{
+			name:    "Should fail when the password is missing",
+			content: `{"username": "user"}`,
+			want:    Credentials{},
+			wantErr: true,
+		},
+		{
+			name:    "Should fail when the file is not JSON",
+			content: "user:secret",
+			want:    Credentials{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := ioutil.TempFile("", "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(file.Name())
+			if _, err := file.WriteString(tt.content); err != nil {
+				t.Fatal(err)
+			}
+			_ = file.Close()
+
+			got, err := FileCredentialsProvider{Path: file.Name()}.Credentials(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Credentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Credentials() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,39 +1,193 @@
 package slsPgx
 
 import (
+	"context"
 	"math"
 	"math/rand"
+	"sync"
 	"time"
 )
 
+// Backoff strategies that can be set as SlsConnConfigParams.BackoffStrategy.
+// See https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+const (
+	// BackoffFullJitter sleeps a random time between 0 and the exponential delay
+	BackoffFullJitter = "fullJitter"
+	// BackoffEqualJitter sleeps half of the exponential delay plus a random time up to the other half
+	BackoffEqualJitter = "equalJitter"
+	// BackoffDecorrelatedJitter sleeps a random time between BackoffBaseMs and three times the previous sleep,
+	// the first sleep is based on BackoffDelayMs
+	BackoffDecorrelatedJitter = "decorrelatedJitter"
+	// BackoffExponential sleeps BackoffBaseMs doubled at every attempt
+	BackoffExponential = "exponential"
+	// BackoffConstant always sleeps BackoffDelayMs
+	BackoffConstant = "constant"
+)
+
+// Clock is used to read the time and to sleep between retries,
+// it can be replaced through SlsConnConfigParams.Clock to run the retries without waiting.
+type Clock interface {
+	Now() time.Time
+	// Sleep waits for d, it returns ctx.Err() if ctx is done first.
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// lockedRand is a *rand.Rand that can be shared by concurrent retries.
+type lockedRand struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (r *lockedRand) Float64() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.rand.Float64()
+}
+
 type delayConfig struct {
 	backoffCapMs   float32
 	backoffBaseMs  float32
 	backoffDelayMs float32
+	strategy       string
+	// custom can be nil, in which case strategy is used
+	custom BackoffStrategy
+	// randSeed can be nil, in which case the current time is used
+	randSeed *int64
+	// clock can be nil, in which case the time package is used
+	clock Clock
+}
+
+// BackoffStrategy computes the delays of a sequence of retries, it can be set as
+// SlsConnConfigParams.CustomBackoffStrategy in place of the built-in strategies.
+// It is shared by the concurrent retries of a connection, so it must be safe for concurrent use.
+type BackoffStrategy interface {
+	// Next returns the delay before the given retry attempt, starting from 1,
+	// previous is the delay before the previous attempt, zero before the first retry.
+	Next(attempt int, previous time.Duration) time.Duration
 }
 
 type delay struct {
-	config delayConfig
+	config   delayConfig
+	rand     *lockedRand
+	clock    Clock
+	strategy BackoffStrategy
 }
 
 func newDelay(config delayConfig) delay {
-	rand.Seed(time.Now().UTC().UnixNano())
-	return delay{
+	seed := time.Now().UTC().UnixNano()
+	if config.randSeed != nil {
+		seed = *config.randSeed
+	}
+
+	var clock Clock = realClock{}
+	if config.clock != nil {
+		clock = config.clock
+	}
+
+	d := delay{
 		config: config,
+		rand:   &lockedRand{rand: rand.New(rand.NewSource(seed))},
+		clock:  clock,
 	}
+	d.strategy = d.newStrategy()
+
+	return d
 }
 
-func (d delay) getDecorrelatedJitterDelayMs() time.Duration {
-	capMs := d.config.backoffCapMs
-	base := d.config.backoffBaseMs
-	backDelay := d.config.backoffDelayMs
-	p1 := base - backDelay * 3 - 1
-	p2 := rand.Float32() * p1
-	randRange := math.Floor(float64(p2)) + float64(backDelay * 3)
+func (d delay) newStrategy() BackoffStrategy {
+	if d.config.custom != nil {
+		return d.config.custom
+	}
+
+	switch d.config.strategy {
+	case BackoffFullJitter:
+		return fullJitter{config: d.config, rand: d.rand}
+	case BackoffEqualJitter:
+		return equalJitter{config: d.config, rand: d.rand}
+	case BackoffExponential:
+		return exponential{config: d.config}
+	case BackoffConstant:
+		return constant{config: d.config}
+	default:
+		return decorrelatedJitter{config: d.config, rand: d.rand}
+	}
+}
 
-	return time.Duration(math.Min(float64(capMs), randRange)) * time.Millisecond
+func msToDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// exponentialMs returns BackoffBaseMs doubled attempt times, bounded by BackoffCapMs.
+func exponentialMs(config delayConfig, attempt int) float64 {
+	return math.Min(float64(config.backoffCapMs), float64(config.backoffBaseMs)*math.Pow(2, float64(attempt)))
+}
+
+type fullJitter struct {
+	config delayConfig
+	rand   *lockedRand
+}
+
+func (f fullJitter) Next(attempt int, previous time.Duration) time.Duration {
+	return msToDuration(f.rand.Float64() * exponentialMs(f.config, attempt))
+}
+
+type equalJitter struct {
+	config delayConfig
+	rand   *lockedRand
+}
+
+func (e equalJitter) Next(attempt int, previous time.Duration) time.Duration {
+	half := exponentialMs(e.config, attempt) / 2
+	return msToDuration(half + e.rand.Float64()*half)
+}
+
+type decorrelatedJitter struct {
+	config delayConfig
+	rand   *lockedRand
+}
+
+func (d decorrelatedJitter) Next(attempt int, previous time.Duration) time.Duration {
+	prevMs := float64(d.config.backoffDelayMs)
+	if previous > 0 {
+		prevMs = float64(previous) / float64(time.Millisecond)
+	}
+	base := float64(d.config.backoffBaseMs)
+	upper := math.Max(base, prevMs*3)
+
+	return msToDuration(math.Min(float64(d.config.backoffCapMs), base+d.rand.Float64()*(upper-base)))
+}
+
+type exponential struct {
+	config delayConfig
+}
+
+func (e exponential) Next(attempt int, previous time.Duration) time.Duration {
+	return msToDuration(exponentialMs(e.config, attempt))
+}
+
+type constant struct {
+	config delayConfig
 }
 
-func (d delay) getDelay() time.Duration {
-	return d.getDecorrelatedJitterDelayMs()
+func (c constant) Next(attempt int, previous time.Duration) time.Duration {
+	return msToDuration(float64(c.config.backoffDelayMs))
 }
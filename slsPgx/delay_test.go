@@ -0,0 +1,181 @@
+package slsPgx
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+const samples = 20000
+
+func sampleDelays(strategy string, attempt int) []float64 {
+	d := newDelay(delayConfig{
+		backoffCapMs:   1000,
+		backoffBaseMs:  10,
+		backoffDelayMs: 100,
+		strategy:       strategy,
+		randSeed:       Int64(1),
+	})
+
+	delays := make([]float64, samples)
+	for i := range delays {
+		var delay time.Duration
+		for a := 1; a <= attempt; a++ {
+			delay = d.strategy.Next(a, delay)
+		}
+		delays[i] = float64(delay) / float64(time.Millisecond)
+	}
+
+	return delays
+}
+
+func stats(values []float64) (min, max, mean, stdDev float64) {
+	min, max = math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+		mean += v
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		stdDev += (v - mean) * (v - mean)
+	}
+	stdDev = math.Sqrt(stdDev / float64(len(values)))
+
+	return min, max, mean, stdDev
+}
+
+func Test_delay_strategies(t *testing.T) {
+	tests := []struct {
+		name       string
+		strategy   string
+		attempt    int
+		wantMin    float64
+		wantMax    float64
+		wantMean   float64
+		wantStdDev float64
+	}{
+		{
+			name:       "full jitter should be uniform between 0 and the exponential delay",
+			strategy:   BackoffFullJitter,
+			attempt:    3,
+			wantMin:    0,
+			wantMax:    80,
+			wantMean:   40,
+			wantStdDev: 80 / math.Sqrt(12),
+		},
+		{
+			name:       "full jitter should be bounded by the cap",
+			strategy:   BackoffFullJitter,
+			attempt:    10,
+			wantMin:    0,
+			wantMax:    1000,
+			wantMean:   500,
+			wantStdDev: 1000 / math.Sqrt(12),
+		},
+		{
+			name:       "equal jitter should be uniform between half and the whole exponential delay",
+			strategy:   BackoffEqualJitter,
+			attempt:    3,
+			wantMin:    40,
+			wantMax:    80,
+			wantMean:   60,
+			wantStdDev: 40 / math.Sqrt(12),
+		},
+		{
+			name:       "decorrelated jitter should be uniform between the base and three times the delay",
+			strategy:   BackoffDecorrelatedJitter,
+			attempt:    1,
+			wantMin:    10,
+			wantMax:    300,
+			wantMean:   155,
+			wantStdDev: 290 / math.Sqrt(12),
+		},
+		{
+			name:       "exponential should double the base at every attempt",
+			strategy:   BackoffExponential,
+			attempt:    3,
+			wantMin:    80,
+			wantMax:    80,
+			wantMean:   80,
+			wantStdDev: 0,
+		},
+		{
+			name:       "exponential should be bounded by the cap",
+			strategy:   BackoffExponential,
+			attempt:    10,
+			wantMin:    1000,
+			wantMax:    1000,
+			wantMean:   1000,
+			wantStdDev: 0,
+		},
+		{
+			name:       "constant should always be the delay",
+			strategy:   BackoffConstant,
+			attempt:    5,
+			wantMin:    100,
+			wantMax:    100,
+			wantMean:   100,
+			wantStdDev: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			min, max, mean, stdDev := stats(sampleDelays(tt.strategy, tt.attempt))
+			// 5 standard errors of the mean
+			tolerance := 5*tt.wantStdDev/math.Sqrt(samples) + 1e-6
+
+			if min < tt.wantMin || max > tt.wantMax {
+				t.Errorf("delays range = [%v, %v], want within [%v, %v]", min, max, tt.wantMin, tt.wantMax)
+			}
+			if math.Abs(mean-tt.wantMean) > tolerance {
+				t.Errorf("delays mean = %v, want %v ± %v", mean, tt.wantMean, tolerance)
+			}
+			if math.Abs(stdDev-tt.wantStdDev) > tt.wantStdDev*0.05+1e-6 {
+				t.Errorf("delays standard deviation = %v, want %v", stdDev, tt.wantStdDev)
+			}
+		})
+	}
+}
+
+func Test_delay_decorrelatedJitterDependsOnPreviousDelay(t *testing.T) {
+	d := newDelay(delayConfig{
+		backoffCapMs:   100000,
+		backoffBaseMs:  10,
+		backoffDelayMs: 100,
+		strategy:       BackoffDecorrelatedJitter,
+		randSeed:       Int64(1),
+	})
+
+	for i := 0; i < samples/10; i++ {
+		var previous time.Duration
+		prev := float64(100)
+		for attempt := 1; attempt <= 5; attempt++ {
+			previous = d.strategy.Next(attempt, previous)
+			delay := float64(previous) / float64(time.Millisecond)
+			if delay < 10 || delay > prev*3 {
+				t.Fatalf("attempt %v delay = %v, want within [10, %v]", attempt, delay, prev*3)
+			}
+			prev = delay
+		}
+	}
+}
+
+func Test_delay_randSeed(t *testing.T) {
+	config := delayConfig{
+		backoffCapMs:   1000,
+		backoffBaseMs:  10,
+		backoffDelayMs: 100,
+		strategy:       BackoffDecorrelatedJitter,
+		randSeed:       Int64(42),
+	}
+	s1 := newDelay(config).strategy
+	s2 := newDelay(config).strategy
+
+	var d1, d2 time.Duration
+	for attempt := 1; attempt <= 10; attempt++ {
+		if d1, d2 = s1.Next(attempt, d1), s2.Next(attempt, d2); d1 != d2 {
+			t.Fatalf("attempt %v delays = %v and %v, want the same delay for the same seed", attempt, d1, d2)
+		}
+	}
+}
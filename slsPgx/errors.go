@@ -0,0 +1,195 @@
+package slsPgx
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jackc/pgconn"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRetriesExhausted is matched, through errors.Is, by the errors returned when retrying gives up
+// after a retryable error, see RetryError and RetryDeadlineError.
+var ErrRetriesExhausted = errors.New("retries exhausted")
+
+// RetryReason classifies the error that made retrying give up.
+type RetryReason string
+
+const (
+	ReasonTooManyConnections  RetryReason = "too_many_connections"
+	ReasonCannotConnectNow    RetryReason = "cannot_connect_now"
+	ReasonAdminShutdown       RetryReason = "admin_shutdown"
+	ReasonCrashShutdown       RetryReason = "crash_shutdown"
+	ReasonConnectionException RetryReason = "connection_exception"
+	ReasonSerialization       RetryReason = "serialization_failure"
+	ReasonDeadlock            RetryReason = "deadlock_detected"
+	ReasonReadOnly            RetryReason = "read_only"
+	ReasonNetwork             RetryReason = "network"
+	ReasonOther               RetryReason = "other"
+)
+
+func retryReason(err error) RetryReason {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		if errors.Is(err, errReadOnlyConnection) {
+			return ReasonReadOnly
+		}
+		if isNetworkError(err) {
+			return ReasonNetwork
+		}
+		return ReasonOther
+	}
+
+	switch {
+	case pgErr.Code == tooManyConnectionsCode:
+		return ReasonTooManyConnections
+	case pgErr.Code == cannotConnectNowCode:
+		return ReasonCannotConnectNow
+	case pgErr.Code == adminShutdownCode:
+		return ReasonAdminShutdown
+	case pgErr.Code == crashShutdownCode:
+		return ReasonCrashShutdown
+	case pgErr.Code == serializationFailureCode:
+		return ReasonSerialization
+	case pgErr.Code == deadlockDetectedCode:
+		return ReasonDeadlock
+	case pgErr.Code == readOnlySQLTransaction:
+		return ReasonReadOnly
+	case strings.HasPrefix(pgErr.Code, connectionExceptionClass):
+		return ReasonConnectionException
+	}
+
+	return ReasonOther
+}
+
+// RetryError is returned when all the BackoffMaxRetries attempts failed with retryable errors.
+// Err is the error of the last attempt, Slept the total time spent sleeping between attempts
+// and ReconnectFailures the number of attempts that failed to replace a terminated connection.
+type RetryError struct {
+	Attempts          int
+	ReconnectFailures int
+	Slept             time.Duration
+	Reason            RetryReason
+	Err               error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("retries exhausted after %v attempts (%v) and %v of backoff: %v", e.Attempts, e.Reason, e.Slept, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RetryError) Is(target error) bool {
+	return target == ErrRetriesExhausted
+}
+
+// RetryDeadlineError is returned when retrying is cut short by the context, either because it is done
+// or because its deadline would expire before the next attempt. Err is the error of the last attempt,
+// Delay the delay that could not be slept and Slept the total time spent sleeping before.
+type RetryDeadlineError struct {
+	Attempts          int
+	ReconnectFailures int
+	Delay             time.Duration
+	Slept             time.Duration
+	Reason            RetryReason
+	CtxErr            error
+	Err               error
+}
+
+func (e *RetryDeadlineError) Error() string {
+	return fmt.Sprintf("retry cut short by the context after %v attempts (%v) and %v of backoff, next delay %v: %v", e.Attempts, e.Reason, e.Slept, e.Delay, e.Err)
+}
+
+func (e *RetryDeadlineError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrRetriesExhausted or the context error that cut retrying short.
+func (e *RetryDeadlineError) Is(target error) bool {
+	return target == ErrRetriesExhausted || target == e.CtxErr
+}
+
+// reconnectError wraps the error of an attempt that failed to replace a terminated connection.
+type reconnectError struct {
+	err error
+}
+
+func (e *reconnectError) Error() string {
+	return "reconnect failed: " + e.err.Error()
+}
+
+func (e *reconnectError) Unwrap() error {
+	return e.err
+}
+
+func isReconnectError(err error) bool {
+	var rErr *reconnectError
+	return errors.As(err, &rErr)
+}
+
+var registeredCodes = struct {
+	sync.RWMutex
+	codes []string
+}{}
+
+// RegisterRetryableCodes adds SQLSTATE codes, or whole classes when two characters long,
+// to the errors that are retried on a new connection. It is safe for concurrent use.
+func RegisterRetryableCodes(codes ...string) {
+	registeredCodes.Lock()
+	defer registeredCodes.Unlock()
+
+	registeredCodes.codes = append(registeredCodes.codes, codes...)
+}
+
+func isRegisteredError(err error) bool {
+	registeredCodes.RLock()
+	defer registeredCodes.RUnlock()
+
+	return containsCode(registeredCodes.codes, err)
+}
+
+// IsRetryable reports whether err is retried by SlsConn and SlsPool, it is the case when the server
+// cannot accept a new connection at the moment, the backend has been terminated, the connection
+// has been lost before a statement was sent or err has a code added with RegisterRetryableCodes.
+func IsRetryable(err error) bool {
+	return err != nil && (isConnectionError(err) || isTerminatedError(err))
+}
+
+// isConnectionError reports whether connecting failed because the server could not accept the connection,
+// or because a read-only instance has been reached instead of the writer.
+func isConnectionError(err error) bool {
+	if containsCode(connectionErrorCodes, err) || isRegisteredError(err) || errors.Is(err, errReadOnlyConnection) {
+		return true
+	}
+
+	return !isPgError(err) && isNetworkError(err)
+}
+
+// isTerminatedError reports whether a statement failed because the backend has been terminated,
+// or the connection lost before sending it, so that it can be safely sent again on a new connection.
+func isTerminatedError(err error) bool {
+	if containsCode(terminatedErrorCodes, err) || isRegisteredError(err) {
+		return true
+	}
+
+	return !isPgError(err) && pgconn.SafeToRetry(err) && isNetworkError(err)
+}
+
+func isPgError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr)
+}
+
+func isNetworkError(err error) bool {
+	if pgconn.Timeout(err) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
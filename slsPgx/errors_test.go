@@ -0,0 +1,209 @@
+package slsPgx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgconn"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// writeError mimics the pgconn errors returned when nothing could be sent to the server.
+type writeError struct {
+	err         error
+	safeToRetry bool
+}
+
+func (e *writeError) Error() string     { return e.err.Error() }
+func (e *writeError) Unwrap() error     { return e.err }
+func (e *writeError) SafeToRetry() bool { return e.safeToRetry }
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	RegisterRetryableCodes("P0001")
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connect: connection refused")}
+
+	tests := []struct {
+		name           string
+		err            error
+		wantConnection bool
+		wantTerminated bool
+	}{
+		{
+			name:           "Should retry too many connections",
+			err:            &pgconn.PgError{Code: tooManyConnectionsCode, Message: "sorry, too many clients already"},
+			wantConnection: true,
+		},
+		{
+			name:           "Should retry too many connections whatever the language of the message",
+			err:            fmt.Errorf("failed to connect: %w", &pgconn.PgError{Code: tooManyConnectionsCode, Message: "désolé, trop de clients sont déjà connectés"}),
+			wantConnection: true,
+		},
+		{
+			name:           "Should retry a server that cannot connect now",
+			err:            &pgconn.PgError{Code: cannotConnectNowCode},
+			wantConnection: true,
+		},
+		{
+			name:           "Should retry any connection exception",
+			err:            &pgconn.PgError{Code: "08006"},
+			wantConnection: true,
+			wantTerminated: true,
+		},
+		{
+			name:           "Should retry a backend terminated by an administrator",
+			err:            &pgconn.PgError{Code: adminShutdownCode, Message: "terminating connection due to administrator command"},
+			wantTerminated: true,
+		},
+		{
+			name:           "Should retry connecting to the writer when a read-only instance has been reached",
+			err:            fmt.Errorf("failed to connect: ValidateConnect failed (%w)", errReadOnlyConnection),
+			wantConnection: true,
+		},
+		{
+			name: "Should not retry a read-only transaction",
+			err:  &pgconn.PgError{Code: readOnlySQLTransaction},
+		},
+		{
+			name:           "Should retry a backend terminated by a crash",
+			err:            &pgconn.PgError{Code: crashShutdownCode},
+			wantTerminated: true,
+		},
+		{
+			name:           "Should retry a registered code",
+			err:            &pgconn.PgError{Code: "P0001"},
+			wantConnection: true,
+			wantTerminated: true,
+		},
+		{
+			name: "Should not retry any other error",
+			err:  &pgconn.PgError{Code: "42P01"},
+		},
+		{
+			name: "Should not retry a serialization failure",
+			err:  &pgconn.PgError{Code: serializationFailureCode},
+		},
+		{
+			name:           "Should retry to connect after a network error",
+			err:            dialErr,
+			wantConnection: true,
+		},
+		{
+			name:           "Should retry a statement that could not be sent",
+			err:            &writeError{err: dialErr, safeToRetry: true},
+			wantConnection: true,
+			wantTerminated: true,
+		},
+		{
+			name:           "Should not retry a statement that might have been sent",
+			err:            &writeError{err: io.ErrUnexpectedEOF, safeToRetry: false},
+			wantConnection: true,
+		},
+		{
+			name: "Should not retry a timeout",
+			err:  &writeError{err: timeoutError{}, safeToRetry: true},
+		},
+		{
+			name: "Should not retry a canceled context",
+			err:  context.Canceled,
+		},
+		{
+			name: "Should not retry a nil error",
+			err:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err == nil {
+				if IsRetryable(tt.err) {
+					t.Errorf("IsRetryable() got = true, want false")
+				}
+				return
+			}
+			if got := isConnectionError(tt.err); got != tt.wantConnection {
+				t.Errorf("isConnectionError() got = %v, want %v", got, tt.wantConnection)
+			}
+			if got := isTerminatedError(tt.err); got != tt.wantTerminated {
+				t.Errorf("isTerminatedError() got = %v, want %v", got, tt.wantTerminated)
+			}
+			if got := IsRetryable(tt.err); got != (tt.wantConnection || tt.wantTerminated) {
+				t.Errorf("IsRetryable() got = %v, want %v", got, tt.wantConnection || tt.wantTerminated)
+			}
+		})
+	}
+}
+
+func Test_retryReason(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want RetryReason
+	}{
+		{name: "too many connections", err: &pgconn.PgError{Code: tooManyConnectionsCode}, want: ReasonTooManyConnections},
+		{name: "cannot connect now", err: &pgconn.PgError{Code: cannotConnectNowCode}, want: ReasonCannotConnectNow},
+		{name: "admin shutdown", err: &pgconn.PgError{Code: adminShutdownCode}, want: ReasonAdminShutdown},
+		{name: "crash shutdown", err: &pgconn.PgError{Code: crashShutdownCode}, want: ReasonCrashShutdown},
+		{name: "connection exception", err: &pgconn.PgError{Code: "08001"}, want: ReasonConnectionException},
+		{name: "serialization failure", err: &pgconn.PgError{Code: serializationFailureCode}, want: ReasonSerialization},
+		{name: "deadlock", err: &pgconn.PgError{Code: deadlockDetectedCode}, want: ReasonDeadlock},
+		{name: "read-only transaction", err: &pgconn.PgError{Code: readOnlySQLTransaction}, want: ReasonReadOnly},
+		{name: "read-only connection", err: errReadOnlyConnection, want: ReasonReadOnly},
+		{name: "network", err: fmt.Errorf("dial: %w", io.EOF), want: ReasonNetwork},
+		{name: "other", err: &pgconn.PgError{Code: "P0001"}, want: ReasonOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryReason(tt.err); got != tt.want {
+				t.Errorf("retryReason() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryError(t *testing.T) {
+	cause := &pgconn.PgError{Code: tooManyConnectionsCode}
+	tests := []struct {
+		name        string
+		err         error
+		wantCtxErr  error
+		wantMessage string
+	}{
+		{
+			name:        "RetryError should wrap the last error",
+			err:         &RetryError{Attempts: 3, Slept: 2 * time.Second, Reason: ReasonTooManyConnections, Err: cause},
+			wantMessage: "retries exhausted after 3 attempts (too_many_connections) and 2s of backoff: " + cause.Error(),
+		},
+		{
+			name:        "RetryDeadlineError should wrap the last error and the context error",
+			err:         &RetryDeadlineError{Attempts: 1, Delay: time.Second, Reason: ReasonTooManyConnections, CtxErr: context.DeadlineExceeded, Err: cause},
+			wantCtxErr:  context.DeadlineExceeded,
+			wantMessage: "retry cut short by the context after 1 attempts (too_many_connections) and 0s of backoff, next delay 1s: " + cause.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := fmt.Errorf("handler: %w", tt.err)
+			if !errors.Is(err, ErrRetriesExhausted) {
+				t.Errorf("errors.Is(%v, ErrRetriesExhausted) got = false, want true", err)
+			}
+			var pgErr *pgconn.PgError
+			if !errors.As(err, &pgErr) || pgErr != cause {
+				t.Errorf("errors.As(%v, *pgconn.PgError) got = %v, want %v", err, pgErr, cause)
+			}
+			if tt.wantCtxErr != nil && !errors.Is(err, tt.wantCtxErr) {
+				t.Errorf("errors.Is(%v, %v) got = false, want true", err, tt.wantCtxErr)
+			}
+			if tt.err.Error() != tt.wantMessage {
+				t.Errorf("Error() got = %v, want %v", tt.err.Error(), tt.wantMessage)
+			}
+		})
+	}
+}
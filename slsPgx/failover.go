@@ -0,0 +1,55 @@
+package slsPgx
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// errReadOnlyConnection is returned when connecting to the writer reaches an instance that is read-only,
+// e.g. because its DNS record has not been updated yet after a failover.
+var errReadOnlyConnection = errors.New("read only connection")
+
+// validateReadWrite returns a ValidateConnectFunc failing with errReadOnlyConnection when the server
+// is read-only, as target_session_attrs=read-write does, and then running validate, if any.
+func validateReadWrite(validate pgconn.ValidateConnectFunc) pgconn.ValidateConnectFunc {
+	return func(ctx context.Context, pgConn *pgconn.PgConn) error {
+		result := pgConn.ExecParams(ctx, "show transaction_read_only", nil, nil, nil, nil).Read()
+		if result.Err != nil {
+			return result.Err
+		}
+		if len(result.Rows) == 1 && len(result.Rows[0]) == 1 && string(result.Rows[0][0]) == "on" {
+			return errReadOnlyConnection
+		}
+
+		if validate != nil {
+			return validate(ctx, pgConn)
+		}
+
+		return nil
+	}
+}
+
+// pgIsInRecovery reports whether the server of conn is a standby, it can be replaced in tests.
+var pgIsInRecovery = func(ctx context.Context, conn *pgx.Conn) (bool, error) {
+	var inRecovery bool
+	err := conn.QueryRow(ctx, "select pg_is_in_recovery()").Scan(&inRecovery)
+	return inRecovery, err
+}
+
+// isFailoverError reports whether err, returned by a statement run on conn, means that the instance
+// is no longer the writer. A read-only error is not enough, a read-only transaction of the caller
+// fails in the same way, so the server itself must be a standby, or be shutting down.
+func isFailoverError(ctx context.Context, conn *pgx.Conn, err error) bool {
+	if !containsCode(readOnlyErrorCodes, err) {
+		return false
+	}
+
+	inRecovery, checkErr := pgIsInRecovery(ctx, conn)
+	if checkErr != nil {
+		return isTerminatedError(checkErr)
+	}
+
+	return inRecovery
+}
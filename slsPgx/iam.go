@@ -0,0 +1,170 @@
+package slsPgx
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	rdsIAMService     = "rds-db"
+	rdsIAMTokenExpiry = 900 * time.Second
+	sigV4Algorithm    = "AWS4-HMAC-SHA256"
+	sigV4DateFormat   = "20060102"
+	sigV4TimeFormat   = "20060102T150405Z"
+	// hex encoded sha256 of an empty payload
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// PasswordProvider returns the password of the database user, SlsConn consults it on every connect
+// and reconnect so that short-lived passwords, like RDS IAM authentication tokens, are never stale.
+type PasswordProvider interface {
+	Password(ctx context.Context) (string, error)
+}
+
+// AWSCredentials are the credentials used to sign RDS IAM authentication tokens.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// EnvAWSCredentials reads the credentials from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN, which are set in the Lambda execution environment.
+func EnvAWSCredentials() (AWSCredentials, error) {
+	creds := AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return AWSCredentials{}, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+
+	return creds, nil
+}
+
+// RDSIAMTokenProvider is a PasswordProvider signing a new RDS IAM authentication token, valid for
+// 15 minutes, on every call. The token is signed locally, no request is made to AWS.
+type RDSIAMTokenProvider struct {
+	// Endpoint is the host and port of the instance, e.g. mydb.123456789012.us-east-1.rds.amazonaws.com:5432
+	Endpoint string
+	Region   string
+	User     string
+	// Credentials are read with EnvAWSCredentials when nil.
+	Credentials func(ctx context.Context) (AWSCredentials, error)
+	// Clock is the time package when nil.
+	Clock Clock
+}
+
+func (p *RDSIAMTokenProvider) Password(ctx context.Context) (string, error) {
+	var creds AWSCredentials
+	var err error
+	if p.Credentials != nil {
+		creds, err = p.Credentials(ctx)
+	} else {
+		creds, err = EnvAWSCredentials()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var clock Clock = realClock{}
+	if p.Clock != nil {
+		clock = p.Clock
+	}
+
+	query := url.Values{}
+	query.Set("Action", "connect")
+	query.Set("DBUser", p.User)
+
+	return p.Endpoint + "/?" + presignV4(creds, p.Region, rdsIAMService, p.Endpoint, "/", query, emptyPayloadHash, rdsIAMTokenExpiry, clock.Now()), nil
+}
+
+// presignV4 returns the query string, signature included, of a GET request presigned with
+// AWS Signature Version 4, see https://docs.aws.amazon.com/general/latest/gr/sigv4-query-string-auth.html
+func presignV4(creds AWSCredentials, region, service, host, path string, query url.Values, payloadHash string, expires time.Duration, now time.Time) string {
+	now = now.UTC()
+	scope := strings.Join([]string{now.Format(sigV4DateFormat), region, service, "aws4_request"}, "/")
+
+	signed := url.Values{}
+	for key, values := range query {
+		signed[key] = values
+	}
+	signed.Set("X-Amz-Algorithm", sigV4Algorithm)
+	signed.Set("X-Amz-Credential", creds.AccessKeyID+"/"+scope)
+	signed.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	signed.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	signed.Set("X-Amz-SignedHeaders", "host")
+	if creds.SessionToken != "" {
+		signed.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	canonicalQuery := canonicalQueryString(signed)
+
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		path,
+		canonicalQuery,
+		"host:" + host + "\n",
+		"host",
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		now.Format(sigV4TimeFormat),
+		scope,
+		hashHex(canonicalRequest),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), now.Format(sigV4DateFormat))
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	return canonicalQuery + "&X-Amz-Signature=" + signature
+}
+
+// canonicalQueryString sorts the parameters and encodes them as RFC 3986 requires.
+func canonicalQueryString(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key)+"="+uriEncode(value))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+func uriEncode(value string) string {
+	return strings.Replace(url.QueryEscape(value), "+", "%20", -1)
+}
+
+func hashHex(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
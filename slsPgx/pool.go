@@ -0,0 +1,350 @@
+package slsPgx
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"sync"
+)
+
+// SlsPool is the pooled counterpart of SlsConn, it wraps a pgxpool.Pool and it is meant
+// for long lived containers serving concurrent requests. It is safe for concurrent use.
+type SlsPool struct {
+	config     slsConnConfig
+	delay      delay
+	tempConfig SlsConnConfigParams
+	pool       *pgxpool.Pool
+	logger     Logger
+	connCred   connCred
+
+	maxConnections maxConnections
+	mu             sync.Mutex
+	// pids of the backends opened by the pool, see Clean, each with the sequence number of its connection
+	pids    map[int]uint64
+	pidsSeq uint64
+	// prefix of the application_name of the connections
+	applicationNamePrefix string
+}
+
+// pgxpool has no hook to set the credentials of each new connection, so a short-lived password
+// would expire in the pool and rotated credentials would never be fetched again.
+var (
+	errPoolPasswordProvider    = errors.New("PasswordProvider is not supported by SlsPool")
+	errPoolCredentialsProvider = errors.New("CredentialsProvider is not supported by SlsPool")
+)
+
+func NewPool(config SlsConnConfigParams) *SlsPool {
+	return &SlsPool{
+		tempConfig: config,
+	}
+}
+
+func (p *SlsPool) Connect(ctx context.Context, connectionString string) error {
+	config, err := pgxpool.ParseConfig(connectionString)
+	if err != nil {
+		return err
+	}
+
+	return p.connect(ctx, config)
+}
+
+func (p *SlsPool) ConnectConfig(ctx context.Context, poolConfig *pgxpool.Config) error {
+	return p.connect(ctx, poolConfig)
+}
+
+func (p *SlsPool) connect(ctx context.Context, poolConfig *pgxpool.Config) error {
+	p.config = newDefaultConfig()
+	if err := p.config.mergeAndValidate(p.tempConfig); err != nil {
+		return err
+	}
+	if p.config.PasswordProvider != nil {
+		return errPoolPasswordProvider
+	}
+	if p.config.CredentialsProvider != nil {
+		return errPoolCredentialsProvider
+	}
+
+	// Work on a copy of the config, the caller's one can be used again for another pool
+	poolConfig = poolConfig.Copy()
+	p.connCred = newConnCred(&poolConfig.ConnConfig.Config)
+	name, prefix := applicationName(p.config, poolConfig.ConnConfig.RuntimeParams)
+	setApplicationName(&poolConfig.ConnConfig.Config, name)
+	p.applicationNamePrefix = prefix
+
+	p.logger = newLogger(p.config.Debug)
+	p.delay = newDelay(delayConfig{
+		backoffCapMs:   p.config.BackoffCapMs,
+		backoffBaseMs:  p.config.BackoffBaseMs,
+		backoffDelayMs: p.config.BackoffDelayMs,
+		strategy:       p.config.BackoffStrategy,
+		custom:         p.config.CustomBackoffStrategy,
+		randSeed:       p.config.RandSeed,
+		clock:          p.config.Clock,
+	})
+
+	// If the pool is already connected do not reconnect
+	if p.pool != nil {
+		return nil
+	}
+
+	afterConnect := poolConfig.AfterConnect
+	poolConfig.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		p.addPid(int(conn.PgConn().PID()))
+		if afterConnect != nil {
+			return afterConnect(ctx, conn)
+		}
+
+		return nil
+	}
+
+	connectCtx, cancel := withBudget(ctx, p.config)
+	defer cancel()
+
+	err := backoff(ctx, p.config, p.delay, p.logger, "Retry connection", func() (bool, error) {
+		pool, err := pgxpool.ConnectConfig(connectCtx, poolConfig)
+		if err != nil {
+			return isConnectionError(err), err
+		}
+
+		p.pool = pool
+
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	p.logger.Info("Connected")
+
+	return nil
+}
+
+func (p *SlsPool) addPid(pid int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pids == nil {
+		p.pids = make(map[int]uint64)
+	}
+	p.pidsSeq++
+	p.pids[pid] = p.pidsSeq
+}
+
+func (p *SlsPool) pidsSnapshot() map[int]uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pids := make(map[int]uint64, len(p.pids))
+	for pid, seq := range p.pids {
+		pids[pid] = seq
+	}
+
+	return pids
+}
+
+// prunePids forgets the pids of the pool connections that no longer exist, e.g. recycled after
+// MaxConnLifetime or terminated. The server reuses pids, a stale one would protect an unrelated backend.
+func (p *SlsPool) prunePids(ctx context.Context) error {
+	pids := p.pidsSnapshot()
+	if len(pids) == 0 {
+		return nil
+	}
+
+	known := make([]int, 0, len(pids))
+	for pid := range pids {
+		known = append(known, pid)
+	}
+	knownArray := &pgtype.Int4Array{}
+	if err := knownArray.Set(known); err != nil {
+		return err
+	}
+
+	rows, err := p.pool.Query(ctx, `SELECT pid FROM pg_stat_activity WHERE pid = ANY ($1);`, knownArray)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	alive := make(map[int]bool, len(pids))
+	for rows.Next() {
+		var pid int
+		if err := rows.Scan(&pid); err != nil {
+			return err
+		}
+		alive[pid] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for pid, seq := range pids {
+		// a connection opened meanwhile may have been given the same pid
+		if !alive[pid] && p.pids[pid] == seq {
+			delete(p.pids, pid)
+		}
+	}
+
+	return nil
+}
+
+func (p *SlsPool) cleaner() cleaner {
+	pids := p.pidsSnapshot()
+	excludedPids := make([]int, 0, len(pids))
+	for pid := range pids {
+		excludedPids = append(excludedPids, pid)
+	}
+
+	stat := p.pool.Stat()
+	pending := int(stat.MaxConns() - stat.TotalConns())
+	if pending < 0 {
+		pending = 0
+	}
+
+	c := cleaner{
+		db:             p.pool,
+		config:         p.config,
+		connCred:       p.connCred,
+		logger:         p.logger,
+		maxConnections: &p.maxConnections,
+		clock:          p.delay.clock,
+		pending:        pending,
+		excludedPids:   excludedPids,
+	}
+	if p.config.CleanOwnApplicationOnly {
+		c.applicationNamePrefix = p.applicationNamePrefix
+	}
+
+	return c
+}
+
+// Clean works like SlsConn.Clean, the connections the pool can still open up to its MaxConns
+// are counted as already in use and the pool's own connections are never terminated.
+func (p *SlsPool) Clean(ctx context.Context) (CleanResult, error) {
+	return p.clean(ctx, false)
+}
+
+// CleanDryRun works like SlsConn.CleanDryRun.
+func (p *SlsPool) CleanDryRun(ctx context.Context) (CleanResult, error) {
+	return p.clean(ctx, true)
+}
+
+func (p *SlsPool) clean(ctx context.Context, dryRun bool) (CleanResult, error) {
+	if err := p.prunePids(ctx); err != nil {
+		return CleanResult{}, err
+	}
+
+	return p.cleaner().clean(ctx, dryRun)
+}
+
+// Utilization works like SlsConn.Utilization, Pending is the number of connections the pool
+// can still open up to its MaxConns.
+func (p *SlsPool) Utilization(ctx context.Context) (Utilization, error) {
+	return p.cleaner().utilization(ctx)
+}
+
+func (p *SlsPool) GetPool() *pgxpool.Pool {
+	return p.pool
+}
+
+func (p *SlsPool) Close() {
+	p.pool.Close()
+}
+
+// Query works like pgxpool.Pool.Query, the query is retried until its first row has been read.
+func (p *SlsPool) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	var rows pgx.Rows
+	err := p.retry(ctx, func() error {
+		var err error
+		rows, err = readFirstRow(p.pool.Query(ctx, sql, args...))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// QueryRow works like pgxpool.Pool.QueryRow, the query is executed when Scan is called.
+func (p *SlsPool) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return &slsPoolRow{
+		p:    p,
+		ctx:  ctx,
+		sql:  sql,
+		args: args,
+	}
+}
+
+type slsPoolRow struct {
+	p    *SlsPool
+	ctx  context.Context
+	sql  string
+	args []interface{}
+}
+
+func (r *slsPoolRow) Scan(dest ...interface{}) error {
+	return r.p.retry(r.ctx, func() error {
+		return r.p.pool.QueryRow(r.ctx, r.sql, r.args...).Scan(dest...)
+	})
+}
+
+func (p *SlsPool) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	var commandTag pgconn.CommandTag
+	err := p.retry(ctx, func() error {
+		var err error
+		commandTag, err = p.pool.Exec(ctx, sql, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return commandTag, nil
+}
+
+// Begin starts a transaction, only starting it is retried, see WithTx to retry the whole transaction.
+func (p *SlsPool) Begin(ctx context.Context) (pgx.Tx, error) {
+	var tx pgx.Tx
+	err := p.retry(ctx, func() error {
+		var err error
+		tx, err = p.pool.Begin(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// WithTx works like SlsConn.WithTx.
+func (p *SlsPool) WithTx(ctx context.Context, txOptions pgx.TxOptions, fn func(pgx.Tx) error) error {
+	return p.retry(ctx, func() error {
+		conn, err := p.pool.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Release()
+
+		return runTx(ctx, conn.Conn(), txOptions, fn)
+	}, txErrorCodes...)
+}
+
+// retry runs fn and runs it again if the backend has been terminated, the pool could not open
+// a new connection or fn fails with one of the given SQLSTATE codes.
+// Terminated connections are discarded by the pool, so there is no need to reconnect.
+func (p *SlsPool) retry(ctx context.Context, fn func() error, retryCodes ...string) error {
+	return backoff(ctx, p.config, p.delay, p.logger, "Retry query", func() (bool, error) {
+		err := fn()
+		if err == nil {
+			return false, nil
+		}
+
+		return isTerminatedError(err) || isConnectionError(err) || containsCode(retryCodes, err), err
+	})
+}
@@ -0,0 +1,210 @@
+package slsPgx
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSlsPool_Query(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    int
+		wantErr bool
+	}{
+		{
+			name:    "Should query successfully even though a pool connection was killed",
+			want:    2,
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(SlsConnConfigParams{})
+			p := NewPool(SlsConnConfigParams{
+				Debug: Bool(true),
+			})
+			if err := s.Connect(context.Background(), connectionString); err != nil {
+				t.Error("Test failed: ", err)
+				return
+			}
+			if err := p.Connect(context.Background(), connectionString+"&pool_max_conns=1"); err != nil {
+				t.Error("Test failed: ", err)
+				return
+			}
+			defer p.Close()
+
+			conn, err := p.GetPool().Acquire(context.Background())
+			if err != nil {
+				t.Error("Test failed: ", err)
+				return
+			}
+			pid := int(conn.Conn().PgConn().PID())
+			conn.Release()
+			// Kill the pool connection and try to query
+			if _, err := s.cleaner().killProcesses(context.Background(), []int{pid}); err != nil {
+				t.Error("Could not kill process: ", err)
+				return
+			}
+
+			var res int
+			err = p.QueryRow(context.Background(), "SELECT 1+1 AS result").Scan(&res)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("QueryRow() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(res, tt.want) {
+				t.Errorf("QueryRow() got = %v, want %v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlsPool_Clean(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       SlsConnConfigParams
+		maxConns     string
+		numOfClients int
+		want         int
+		wantErr      bool
+	}{
+		{
+			name:         "Should cleanup zombie connections but not the pool ones",
+			config:       SlsConnConfigParams{Debug: Bool(true)},
+			maxConns:     "5",
+			numOfClients: 80,
+			want:         79,
+			wantErr:      false,
+		},
+		{
+			name:         "Should cleanup zombie connections to leave room for the pool max connections",
+			config:       SlsConnConfigParams{Debug: Bool(true)},
+			maxConns:     "30",
+			numOfClients: 60,
+			want:         59,
+			wantErr:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPool(tt.config)
+			if err := p.Connect(context.Background(), connectionString+"&pool_min_conns=1&pool_max_conns="+tt.maxConns); err != nil {
+				t.Error("Test failed: ", err)
+				return
+			}
+			defer p.Close()
+			mockClients := createMockClients(tt.numOfClients)
+
+			time.Sleep(1 * time.Second)
+			// Wake up a client
+			if _, err := mockClients[0].Query(context.Background(), "SELECT 1+1 AS result"); err != nil {
+				t.Error("Test failed: ", err)
+				return
+			}
+
+			got, err := p.Clean(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Clean() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(len(got.Terminated), tt.want) {
+				t.Errorf("Killed process = %v, want %v", len(got.Terminated), tt.want)
+			}
+
+			cleanMockClients(mockClients)
+		})
+	}
+}
+
+func TestSlsPool_Connect_providers(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  SlsConnConfigParams
+		wantErr error
+	}{
+		{
+			name: "Should not accept a PasswordProvider",
+			config: SlsConnConfigParams{
+				PasswordProvider: &RDSIAMTokenProvider{Endpoint: "localhost:5432", Region: "us-east-1", User: "postgres"},
+			},
+			wantErr: errPoolPasswordProvider,
+		},
+		{
+			name: "Should not accept a CredentialsProvider",
+			config: SlsConnConfigParams{
+				CredentialsProvider: EnvCredentialsProvider{},
+			},
+			wantErr: errPoolCredentialsProvider,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPool(tt.config)
+			err := p.Connect(context.Background(), connectionString)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Connect() error = %v, want %v", err, tt.wantErr)
+			}
+			if p.GetPool() != nil {
+				t.Errorf("Connect() opened the pool")
+			}
+		})
+	}
+}
+
+func TestSlsPool_prunePids(t *testing.T) {
+	s := New(SlsConnConfigParams{})
+	p := NewPool(SlsConnConfigParams{})
+	if err := s.Connect(context.Background(), connectionString); err != nil {
+		t.Error("Test failed: ", err)
+		return
+	}
+	defer s.Close(context.Background())
+	if err := p.Connect(context.Background(), connectionString+"&pool_max_conns=1"); err != nil {
+		t.Error("Test failed: ", err)
+		return
+	}
+	defer p.Close()
+
+	conn, err := p.GetPool().Acquire(context.Background())
+	if err != nil {
+		t.Error("Test failed: ", err)
+		return
+	}
+	pid := int(conn.Conn().PgConn().PID())
+	conn.Release()
+	if _, err := s.cleaner().killProcesses(context.Background(), []int{pid}); err != nil {
+		t.Error("Could not kill process: ", err)
+		return
+	}
+
+	if err := p.prunePids(context.Background()); err != nil {
+		t.Errorf("prunePids() error = %v", err)
+	}
+	if _, ok := p.pidsSnapshot()[pid]; ok {
+		t.Errorf("prunePids() kept the pid %v of the terminated connection", pid)
+	}
+}
+
+func TestSlsPool_ConnectConfig_copiesConfig(t *testing.T) {
+	poolConfig, err := pgxpool.ParseConfig(connectionString)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		p := NewPool(SlsConnConfigParams{BackoffMaxRetries: Int(1)})
+		if err := p.ConnectConfig(context.Background(), poolConfig); err == nil {
+			p.Close()
+		}
+	}
+
+	if poolConfig.AfterConnect != nil {
+		t.Errorf("ConnectConfig() set AfterConnect of the caller's config")
+	}
+	if name, ok := poolConfig.ConnConfig.RuntimeParams["application_name"]; ok {
+		t.Errorf("ConnectConfig() set application_name = %v in the caller's config", name)
+	}
+}
@@ -0,0 +1,76 @@
+package slsPgx
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// backoff calls attempt until it succeeds, it fails with an error that should not be retried
+// or BackoffMaxRetries attempts have been made, sleeping between attempts.
+// attempt reports whether its error is worth another attempt.
+// A RetryError is returned when the last attempt fails with an error worth another attempt,
+// a RetryDeadlineError is returned when ctx is done, or the next attempt would start
+// within DeadlineReserveMs of its deadline.
+// At least one attempt is made, even when BackoffMaxRetries is not positive.
+// Attempts failing with a reconnectError are logged and counted as reconnect failures.
+func backoff(ctx context.Context, config slsConnConfig, d delay, logger Logger, action string, attempt func() (bool, error)) error {
+	maxAttempts := config.BackoffMaxRetries
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	var slept, delay time.Duration
+	reconnectFailures := 0
+	for i := 1; ; i++ {
+		retry, err := attempt()
+		if err == nil {
+			return nil
+		}
+
+		if isReconnectError(err) {
+			reconnectFailures++
+			logger.Failure(fmt.Errorf("%v...Attempt %v: %w", action, i, err))
+		}
+
+		if !retry {
+			return err
+		}
+
+		if i >= maxAttempts {
+			return &RetryError{Attempts: i, ReconnectFailures: reconnectFailures, Slept: slept, Reason: retryReason(err), Err: err}
+		}
+
+		delay = d.strategy.Next(i, delay)
+		if deadline, ok := budgetDeadline(ctx, config); ok && deadline.Sub(d.clock.Now()) < delay {
+			return &RetryDeadlineError{Attempts: i, ReconnectFailures: reconnectFailures, Delay: delay, Slept: slept, Reason: retryReason(err), CtxErr: context.DeadlineExceeded, Err: err}
+		}
+		if ctxErr := d.clock.Sleep(ctx, delay); ctxErr != nil {
+			return &RetryDeadlineError{Attempts: i, ReconnectFailures: reconnectFailures, Delay: delay, Slept: slept, Reason: retryReason(err), CtxErr: ctxErr, Err: err}
+		}
+		slept += delay
+		logger.Info(fmt.Sprintf("%v...Retry attempt: %v with delay: %v", action, i, delay))
+	}
+}
+
+// budgetDeadline returns the deadline of ctx minus DeadlineReserveMs.
+func budgetDeadline(ctx context.Context, config slsConnConfig) (time.Time, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return time.Time{}, false
+	}
+	reserve := time.Duration(float64(config.DeadlineReserveMs) * float64(time.Millisecond))
+
+	return deadline.Add(-reserve), true
+}
+
+// withBudget returns a copy of ctx that expires DeadlineReserveMs before ctx does.
+// It must not be used for queries, whose rows are read after they return, but only to connect.
+func withBudget(ctx context.Context, config slsConnConfig) (context.Context, context.CancelFunc) {
+	deadline, ok := budgetDeadline(ctx, config)
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithDeadline(ctx, deadline)
+}
@@ -0,0 +1,314 @@
+package slsPgx
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgconn"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeClock moves forward only when sleeping, recording every sleep.
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.now = c.now.Add(d)
+	c.slept = append(c.slept, d)
+
+	return nil
+}
+
+func Test_backoff(t *testing.T) {
+	retryableErr := &pgconn.PgError{Code: adminShutdownCode}
+	otherErr := errors.New("some error")
+	tests := []struct {
+		name         string
+		delayMs      float32
+		reserveMs    float32
+		timeout      time.Duration
+		cancelAfter  time.Duration
+		failures     int
+		err          error
+		wantAttempts int
+		wantExhaust  bool
+		wantDeadline bool
+		wantCtxErr   error
+		wantErr      error
+		maxElapsed   time.Duration
+	}{
+		{
+			name:         "Should succeed after retrying",
+			delayMs:      10,
+			failures:     2,
+			err:          retryableErr,
+			wantAttempts: 3,
+			wantErr:      nil,
+			maxElapsed:   time.Second,
+		},
+		{
+			name:         "Should not retry an error that is not retryable",
+			delayMs:      10,
+			failures:     3,
+			err:          otherErr,
+			wantAttempts: 1,
+			wantErr:      otherErr,
+			maxElapsed:   time.Second,
+		},
+		{
+			name:         "Should return the last error when retries are exhausted",
+			delayMs:      10,
+			failures:     3,
+			err:          retryableErr,
+			wantAttempts: 3,
+			wantExhaust:  true,
+			wantErr:      retryableErr,
+			maxElapsed:   time.Second,
+		},
+		{
+			name:         "Should not sleep past the context deadline",
+			delayMs:      1000,
+			timeout:      200 * time.Millisecond,
+			failures:     3,
+			err:          retryableErr,
+			wantAttempts: 1,
+			wantExhaust:  true,
+			wantDeadline: true,
+			wantCtxErr:   context.DeadlineExceeded,
+			wantErr:      retryableErr,
+			maxElapsed:   100 * time.Millisecond,
+		},
+		{
+			name:         "Should not sleep into the reserved time before the context deadline",
+			delayMs:      100,
+			reserveMs:    250,
+			timeout:      300 * time.Millisecond,
+			failures:     3,
+			err:          retryableErr,
+			wantAttempts: 1,
+			wantExhaust:  true,
+			wantDeadline: true,
+			wantCtxErr:   context.DeadlineExceeded,
+			wantErr:      retryableErr,
+			maxElapsed:   50 * time.Millisecond,
+		},
+		{
+			name:         "Should stop sleeping when the context is canceled",
+			delayMs:      1000,
+			cancelAfter:  50 * time.Millisecond,
+			failures:     3,
+			err:          retryableErr,
+			wantAttempts: 1,
+			wantExhaust:  true,
+			wantDeadline: true,
+			wantCtxErr:   context.Canceled,
+			wantErr:      retryableErr,
+			maxElapsed:   500 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			if tt.cancelAfter > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithCancel(ctx)
+				time.AfterFunc(tt.cancelAfter, cancel)
+			}
+
+			config := newDefaultConfig()
+			config.DeadlineReserveMs = tt.reserveMs
+			d := newDelay(delayConfig{
+				backoffCapMs:   tt.delayMs,
+				backoffBaseMs:  config.BackoffBaseMs,
+				backoffDelayMs: tt.delayMs,
+				strategy:       BackoffConstant,
+			})
+
+			attempts := 0
+			start := time.Now()
+			err := backoff(ctx, config, d, newLogger(false), "Retry", func() (bool, error) {
+				attempts++
+				if attempts <= tt.failures {
+					return isTerminatedError(tt.err), tt.err
+				}
+
+				return false, nil
+			})
+			elapsed := time.Since(start)
+
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("backoff() error = %v, want %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrRetriesExhausted) != tt.wantExhaust {
+				t.Errorf("backoff() error = %v, want retries exhausted %v", err, tt.wantExhaust)
+			}
+			var deadlineErr *RetryDeadlineError
+			if errors.As(err, &deadlineErr) != tt.wantDeadline {
+				t.Errorf("backoff() error = %v, want deadline error %v", err, tt.wantDeadline)
+			}
+			if tt.wantCtxErr != nil && !errors.Is(err, tt.wantCtxErr) {
+				t.Errorf("backoff() error = %v, want %v", err, tt.wantCtxErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("backoff() attempts = %v, want %v", attempts, tt.wantAttempts)
+			}
+			if elapsed > tt.maxElapsed {
+				t.Errorf("backoff() took %v, want less than %v", elapsed, tt.maxElapsed)
+			}
+		})
+	}
+}
+
+// linearBackoff is a custom BackoffStrategy adding step to the previous delay.
+type linearBackoff struct {
+	step time.Duration
+}
+
+func (l linearBackoff) Next(attempt int, previous time.Duration) time.Duration {
+	return previous + l.step
+}
+
+func Test_backoff_schedule(t *testing.T) {
+	retryableErr := &pgconn.PgError{Code: adminShutdownCode}
+	tests := []struct {
+		name        string
+		config      SlsConnConfigParams
+		timeout     time.Duration
+		wantSlept   []time.Duration
+		wantTimeout bool
+	}{
+		{
+			name: "Should sleep the exponential delays",
+			config: SlsConnConfigParams{
+				BackoffStrategy:   String(BackoffExponential),
+				BackoffBaseMs:     Float32(10),
+				BackoffMaxRetries: Int(5),
+			},
+			wantSlept: []time.Duration{
+				20 * time.Millisecond,
+				40 * time.Millisecond,
+				80 * time.Millisecond,
+				160 * time.Millisecond,
+			},
+		},
+		{
+			name: "Should sleep the constant delays until the deadline reserve",
+			config: SlsConnConfigParams{
+				BackoffStrategy:   String(BackoffConstant),
+				BackoffDelayMs:    Float32(100),
+				BackoffMaxRetries: Int(10),
+				DeadlineReserveMs: Float32(150),
+			},
+			timeout: 500 * time.Millisecond,
+			wantSlept: []time.Duration{
+				100 * time.Millisecond,
+				100 * time.Millisecond,
+				100 * time.Millisecond,
+			},
+			wantTimeout: true,
+		},
+		{
+			name: "Should sleep the delays of the custom strategy",
+			config: SlsConnConfigParams{
+				BackoffStrategy:       String(BackoffConstant),
+				CustomBackoffStrategy: linearBackoff{step: 50 * time.Millisecond},
+				BackoffMaxRetries:     Int(4),
+			},
+			wantSlept: []time.Duration{
+				50 * time.Millisecond,
+				100 * time.Millisecond,
+				150 * time.Millisecond,
+			},
+		},
+		{
+			name: "Should sleep the same random delays for the same seed",
+			config: SlsConnConfigParams{
+				BackoffMaxRetries: Int(4),
+				RandSeed:          Int64(7),
+			},
+			wantSlept: func() []time.Duration {
+				s := newDelay(delayConfig{
+					backoffCapMs:   1000,
+					backoffBaseMs:  2,
+					backoffDelayMs: 1000,
+					randSeed:       Int64(7),
+				}).strategy
+				d1 := s.Next(1, 0)
+				d2 := s.Next(2, d1)
+				return []time.Duration{d1, d2, s.Next(3, d2)}
+			}(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Now()}
+			tt.config.Clock = clock
+			config := newDefaultConfig()
+			if err := config.mergeAndValidate(tt.config); err != nil {
+				t.Error("Test failed: ", err)
+				return
+			}
+			d := newDelay(delayConfig{
+				backoffCapMs:   config.BackoffCapMs,
+				backoffBaseMs:  config.BackoffBaseMs,
+				backoffDelayMs: config.BackoffDelayMs,
+				strategy:       config.BackoffStrategy,
+				custom:         config.CustomBackoffStrategy,
+				randSeed:       config.RandSeed,
+				clock:          config.Clock,
+			})
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, clock.now.Add(tt.timeout))
+				defer cancel()
+			}
+
+			err := backoff(ctx, config, d, newLogger(false), "Retry", func() (bool, error) {
+				return true, retryableErr
+			})
+			if !errors.Is(err, retryableErr) {
+				t.Errorf("backoff() error = %v, want %v", err, retryableErr)
+			}
+			var deadlineErr *RetryDeadlineError
+			if errors.As(err, &deadlineErr) != tt.wantTimeout {
+				t.Errorf("backoff() error = %v, want deadline error %v", err, tt.wantTimeout)
+			}
+			if !reflect.DeepEqual(clock.slept, tt.wantSlept) {
+				t.Errorf("backoff() slept = %v, want %v", clock.slept, tt.wantSlept)
+			}
+
+			var wantTotal time.Duration
+			for _, d := range tt.wantSlept {
+				wantTotal += d
+			}
+			var slept time.Duration
+			var retryErr *RetryError
+			if errors.As(err, &retryErr) {
+				slept = retryErr.Slept
+			}
+			if errors.As(err, &deadlineErr) {
+				slept = deadlineErr.Slept
+			}
+			if slept != wantTotal {
+				t.Errorf("backoff() error slept = %v, want %v", slept, wantTotal)
+			}
+		})
+	}
+}
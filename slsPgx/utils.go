@@ -1,20 +1,88 @@
 package slsPgx
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
-	"reflect"
+	"github.com/jackc/pgconn"
+	"os"
 	"strings"
 )
 
-type statActivity struct {
-	pid int
-}
-
 type connCred struct {
 	database string
 	host     string
 	user     string
-	url      string
+}
+
+// newConnCred takes the identity of the connections from the parsed config, so that any connection
+// string format and configs changed after parsing are supported. The user and the database
+// fall back to PGUSER and PGDATABASE, and the database to the user as PostgreSQL does.
+func newConnCred(config *pgconn.Config) connCred {
+	c := connCred{
+		database: config.Database,
+		host:     config.Host,
+		user:     config.User,
+	}
+	if c.user == "" {
+		c.user = os.Getenv("PGUSER")
+	}
+	if c.database == "" {
+		c.database = os.Getenv("PGDATABASE")
+	}
+	if c.database == "" {
+		c.database = c.user
+	}
+
+	return c
+}
+
+// maxApplicationNameLength is the length application_name is truncated to by the server, NAMEDATALEN - 1.
+const maxApplicationNameLength = 63
+
+// instanceID tells apart the connections of the different instances, e.g. the Lambda containers, of the same function.
+var instanceID = newInstanceID()
+
+func newInstanceID() string {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "0"
+	}
+
+	return hex.EncodeToString(id)
+}
+
+// applicationName returns the application_name of the connections and the prefix identifying them,
+// see SlsConnConfigParams.ApplicationNamePrefix. The prefix is shortened when the application_name
+// would be truncated by the server, its end is replaced by a hash of the whole prefix so that
+// long prefixes sharing their beginning stay different.
+func applicationName(config slsConnConfig, runtimeParams map[string]string) (string, string) {
+	if config.ApplicationNamePrefix == "" && runtimeParams["application_name"] != "" {
+		return runtimeParams["application_name"], runtimeParams["application_name"]
+	}
+
+	prefix := config.ApplicationNamePrefix
+	if prefix == "" {
+		prefix = "slspgx"
+		if function := os.Getenv("AWS_LAMBDA_FUNCTION_NAME"); function != "" {
+			prefix += ":" + function
+		}
+	}
+
+	suffix := ":" + instanceID
+	if len(prefix)+len(suffix) > maxApplicationNameLength {
+		hash := "~" + hashHex(prefix)[:8]
+		prefix = prefix[:maxApplicationNameLength-len(suffix)-len(hash)] + hash
+	}
+
+	return prefix + suffix, prefix
+}
+
+func setApplicationName(config *pgconn.Config, name string) {
+	if config.RuntimeParams == nil {
+		config.RuntimeParams = make(map[string]string)
+	}
+	config.RuntimeParams["application_name"] = name
 }
 
 func Int(value int) *int {
@@ -29,44 +97,50 @@ func Float32(value float32) *float32 {
 	return &value
 }
 
+func Int64(value int64) *int64 {
+	return &value
+}
+
+func String(value string) *string {
+	return &value
+}
+
+// SQLSTATE codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
 const (
-	tooManyClientsErr        = "sorry, too many clients already"
-	terminatingConnectionErr = "terminating connection due to administrator command"
-	replicationConnectionsSlotErr = "remaining connection slots are reserved for non-replication superuser connections"
+	connectionExceptionClass  = "08"
+	tooManyConnectionsCode    = "53300"
+	adminShutdownCode         = "57P01"
+	crashShutdownCode         = "57P02"
+	cannotConnectNowCode      = "57P03"
+	serializationFailureCode  = "40001"
+	deadlockDetectedCode      = "40P01"
+	invalidAuthorizationClass = "28"
+	readOnlySQLTransaction    = "25006"
 )
 
 var (
-	connectionErrors = []string{
-		tooManyClientsErr,
-		replicationConnectionsSlotErr,
-	}
-	queryErrors = []string{terminatingConnectionErr}
+	// the server cannot accept a new connection at the moment
+	connectionErrorCodes = []string{tooManyConnectionsCode, cannotConnectNowCode, connectionExceptionClass}
+	// the backend has been terminated or the connection has been lost
+	terminatedErrorCodes = []string{adminShutdownCode, crashShutdownCode, connectionExceptionClass}
+	txErrorCodes         = []string{serializationFailureCode, deadlockDetectedCode}
+	// the user or the password have been rejected
+	authErrorCodes = []string{invalidAuthorizationClass}
+	// the instance is read-only, e.g. it is no longer the writer after a failover
+	readOnlyErrorCodes = []string{readOnlySQLTransaction}
 )
 
-func containsError(s []string, e error) bool {
-	for _, a := range s {
-		if strings.Contains(e.Error(), a) {
+// containsCode reports whether e is a PostgreSQL error with one of the given SQLSTATE codes,
+// a code of two characters matches the whole class.
+func containsCode(codes []string, e error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(e, &pgErr) {
+		return false
+	}
+	for _, code := range codes {
+		if pgErr.Code == code || (len(code) == 2 && strings.HasPrefix(pgErr.Code, code)) {
 			return true
 		}
 	}
 	return false
 }
-
-func callFuncByName(myClass interface{}, funcName string, params ...interface{}) (reflect.Value, error) {
-	myClassValue := reflect.ValueOf(myClass)
-	m := myClassValue.MethodByName(funcName)
-	if !m.IsValid() {
-		return reflect.Value{}, errors.New("method not found: " + funcName)
-	}
-	in := make([]reflect.Value, len(params))
-	for i, param := range params {
-		in[i] = reflect.ValueOf(param)
-	}
-	res := m.Call(in)
-	outputErr, ok := res[1].Interface().(error)
-	if ok {
-		return reflect.Value{}, outputErr
-	}
-
-	return res[0], nil
-}